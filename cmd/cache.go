@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manages the cache of the gcloud projects and clusters",
+	Long: `Manages the cache of the gcloud projects, folders and clusters listed by
+generate --from gcloud and the shell completion, kept per gcloud account in
+the user cache directory until they expire.`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Removes the cached gcloud projects and clusters",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache := newCache(&filesystem.Default{})
+		if cache == nil {
+			exitWithError(fmt.Errorf("cannot find the cache directory"))
+		}
+		removed, err := cache.Clear()
+		if err != nil {
+			exitWithError(err)
+		}
+		logger.Info("Cleared cache", "dir", cache.Dir(), "entries", removed)
+	},
+}
+
+var cacheTTL = gcloud.DefaultCacheTTL
+
+// newCache returns the cache of the gcloud projects and clusters
+// in the user cache directory stored with fs, or nil when there is none
+func newCache(fs filesystem.FileSystem) *gcloud.Cache {
+	dir, err := gcloud.DefaultCacheDir()
+	if err != nil {
+		logger.Debug("Not caching gcloud projects and clusters", "error", err)
+		return nil
+	}
+	return gcloud.NewCache(dir, fs, cacheTTL)
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
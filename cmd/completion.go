@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
+)
+
+// completionTimeout limits how long completing project IDs waits for gcloud
+const completionTimeout = 5 * time.Second
+
+var completionCmd = &cobra.Command{
+	Use:   "completion <bash|zsh|fish>",
+	Short: "Generates shell completion scripts",
+	Long: `Generates the completion script for the given shell, which completes
+commands, flags, context names, sources, project IDs, cluster IDs, cluster
+labels and cluster statuses.
+
+Bash:
+  source <(kube-tmuxp completion bash)
+
+Zsh:
+  kube-tmuxp completion zsh > "${fpath[1]}/_kube-tmuxp"
+
+Fish:
+  kube-tmuxp completion fish > ~/.config/fish/completions/kube-tmuxp.fish`,
+	Args:                  cobra.ExactValidArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = rootCmd.GenBashCompletion(cmd.OutOrStdout())
+		case "zsh":
+			err = rootCmd.GenZshCompletion(cmd.OutOrStdout())
+		case "fish":
+			err = rootCmd.GenFishCompletion(cmd.OutOrStdout(), true)
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+// completeContexts completes the context names of the config
+// of the command along with the sessions in the tmuxp directory
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfgFile, _ := cmd.Flags().GetString("config")
+	cfg, err := loadConfig(cfgFile, &filesystem.Default{}, newCommander(nil))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	sessions, _ := cfg.Sessions()
+	return matching(append(cfg.Contexts(), sessions...), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProjectIDs completes the last of the comma separated project IDs
+// with the projects of the config and the ones gcloud can access in the
+// scope given with --organization, --folder and --project-filter, with
+// the identities given with --accounts and --gcloud-configurations
+func completeProjectIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ids := configProjectIDs(cmd)
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	organization, _ := cmd.Flags().GetString("organization")
+	folder, _ := cmd.Flags().GetString("folder")
+	projectFilter, _ := cmd.Flags().GetString("project-filter")
+	scope, err := gcloud.NewProjectScope(organization, folder, projectFilter)
+	if err != nil {
+		return completeLastValue(ids, toComplete)
+	}
+	for _, identity := range completionIdentities(cmd) {
+		cmdr := identity.Commander(completionCommander())
+		if filter, err := scope.Expression(ctx, cmdr); err == nil {
+			if projects, err := gcloud.ListProjects(ctx, cmdr, filter); err == nil {
+				ids = append(ids, projects.IDs()...)
+			}
+		}
+	}
+	return completeLastValue(ids, toComplete)
+}
+
+// completionIdentities returns the identities given with --accounts and
+// --gcloud-configurations, or else the active one
+func completionIdentities(cmd *cobra.Command) []gcloud.Identity {
+	var identities []gcloud.Identity
+	accounts, _ := cmd.Flags().GetStringSlice("accounts")
+	for _, account := range accounts {
+		identities = append(identities, gcloud.Identity{Account: account})
+	}
+	configurations, _ := cmd.Flags().GetStringSlice("gcloud-configurations")
+	for _, configuration := range configurations {
+		identities = append(identities, gcloud.Identity{Configuration: configuration})
+	}
+	if len(identities) == 0 {
+		return []gcloud.Identity{{}}
+	}
+	return identities
+}
+
+// completeClusterLabels completes the last of the comma separated labels
+// with the key=value labels of the clusters of the completion projects
+func completeClusterLabels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var labels []string
+	for _, clusters := range completionClusters(cmd) {
+		for _, cluster := range clusters {
+			for key, value := range cluster.ResourceLabels {
+				labels = append(labels, fmt.Sprintf("%s=%s", key, value))
+			}
+		}
+	}
+	return completeLastValue(labels, toComplete)
+}
+
+// completeClusterIDs completes the last of the comma separated cluster
+// IDs with the clusters of the completion projects
+func completeClusterIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var ids []string
+	for projectID, clusters := range completionClusters(cmd) {
+		for _, cluster := range clusters {
+			ids = append(ids, gcloud.ClusterID(projectID, cluster))
+		}
+	}
+	return completeLastValue(ids, toComplete)
+}
+
+// completionClusters lists the clusters of the projects given with
+// --project-ids, or else of the projects of the config
+func completionClusters(cmd *cobra.Command) map[string]gcloud.Clusters {
+	ids, _ := cmd.Flags().GetStringSlice("project-ids")
+	if len(ids) == 0 {
+		ids = configProjectIDs(cmd)
+	}
+
+	clusters := map[string]gcloud.Clusters{}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	cmdr := completionCommander()
+	for _, id := range ids {
+		if projectClusters, err := gcloud.ListClusters(ctx, cmdr, id); err == nil {
+			clusters[id] = projectClusters
+		}
+	}
+	return clusters
+}
+
+// completionCommander returns the Commander listing gcloud projects and
+// clusters for completions, reusing the cached ones so that they are fast
+func completionCommander() commander.Commander {
+	if cache := newCache(&filesystem.Default{}); cache != nil {
+		return cache.Commander(newCommander(nil), false, nil)
+	}
+	return newCommander(nil)
+}
+
+// configProjectIDs returns the projects of the config of the command
+func configProjectIDs(cmd *cobra.Command) []string {
+	var ids []string
+	cfgFile, _ := cmd.Flags().GetString("config")
+	if cfg, err := loadConfig(cfgFile, &filesystem.Default{}, newCommander(nil)); err == nil {
+		for _, project := range cfg.Projects {
+			ids = append(ids, project.Name)
+		}
+	}
+	return ids
+}
+
+// commaSeparatedCompletions completes the last of the comma separated values with the given choices
+func commaSeparatedCompletions(choices ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeLastValue(choices, toComplete)
+	}
+}
+
+// completeLastValue completes the last of the comma
+// separated values in toComplete with the candidates
+func completeLastValue(candidates []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	var completions []string
+	for _, candidate := range matching(candidates, toComplete) {
+		completions = append(completions, prefix+candidate)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// fixedCompletions completes the given choices
+func fixedCompletions(choices ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return matching(choices, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// matching returns the sorted unique candidates starting with prefix
+func matching(candidates []string, prefix string) []string {
+	seen := map[string]bool{}
+	var matches []string
+	for _, candidate := range candidates {
+		if candidate != "" && strings.HasPrefix(candidate, prefix) && !seen[candidate] {
+			seen[candidate] = true
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/doctor"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks the environment for tools, logins and configs required by kube-tmuxp",
+	Run: func(cmd *cobra.Command, args []string) {
+		fs := &filesystem.Default{}
+		cmdr := newCommander(logger)
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+		results := doctor.New(fs, cmdr, doctorCfgFile, outputOverrides()).Run(ctx)
+
+		var err error
+		switch doctorOutput {
+		case "text":
+			err = results.WriteText(cmd.OutOrStdout())
+		case "json":
+			err = results.WriteJSON(cmd.OutOrStdout())
+		default:
+			err = fmt.Errorf("invalid output format: valid formats are text,json")
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if results.HasFailures() {
+			os.Exit(1)
+		}
+	},
+}
+
+var doctorCfgFile, doctorOutput string
+
+func init() {
+	doctorCmd.Flags().StringVar(&doctorCfgFile, "config", getDefaultConfigPath(), "config file")
+	doctorCmd.Flags().StringVarP(&doctorOutput, "output", "o", "text", "output format: text or json")
+	_ = doctorCmd.RegisterFlagCompletionFunc("output", fixedCompletions("text", "json"))
+	rootCmd.AddCommand(doctorCmd)
+}
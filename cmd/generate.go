@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
 )
 
 var generateCmd = &cobra.Command{
@@ -18,47 +20,129 @@ var generateCmd = &cobra.Command{
 	Aliases: []string{"gen"},
 	Short:   "Generates tmuxp configs for various Kubernetes contexts",
 	Run: func(cmd *cobra.Command, args []string) {
+		var fs filesystem.FileSystem = &filesystem.Default{}
+		var cmdr commander.Commander = newCommander(logger)
+		var overlay *filesystem.Memory
+		if dryRun {
+			var err error
+			overlay, err = filesystem.NewOverlay(fs)
+			if err != nil {
+				exitWithError(err)
+			}
+			fs = overlay
+		}
+		// the cache is written through fs too so that a dry run changes nothing on disk
 		options := generator.Options{
 			From:           from,
 			AllProjects:    allProjects,
 			ProjectIDs:     projectIDs,
+			Organization:   organization,
+			Folder:         folder,
+			ProjectFilter:  projectFilter,
+			Accounts:       accounts,
+			Configurations: gcloudConfigurations,
 			AdditionalEnvs: additionalEnvs,
+			ClusterFilter:  clusterFilter,
+			ClusterLabels:  clusterLabels,
+			Statuses:       statuses,
+			ClusterIDs:     clusterIDs,
+			MergeInto:      mergeInto,
+			Concurrency:    concurrency,
+			Cache:          newCache(fs),
+			Refresh:        refresh,
 			Apply:          apply,
 			CfgFile:        cfgFile,
+			Watch:          watchConfig,
+			Force:          force,
+			Wait:           wait,
+			DryRun:         dryRun,
+			Output:         outputOverrides(),
 		}
-		fs := &filesystem.Default{}
-		cmdr := &commander.Default{}
 
-		generator, err := generator.NewGenerator(options, fs, cmdr)
+		generator, err := generator.NewGenerator(options, fs, cmdr, logger)
 		if err != nil {
-			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), err.Error())
-			os.Exit(1)
+			exitWithError(err)
+		}
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+		generator.Generate(ctx, cmd.OutOrStdout())
+
+		if dryRun {
+			printDryRunChanges(cmd.OutOrStdout(), overlay.Snapshot())
 		}
-		generator.Generate(cmd.OutOrStderr(), cmd.ErrOrStderr())
 	},
 }
 
+// printDryRunChanges prints the files that a dry run would have written or removed
+func printDryRunChanges(out io.Writer, changes []filesystem.Entry) {
+	if len(changes) == 0 {
+		_, _ = fmt.Fprintln(out, "\nDry run: no files would be changed")
+		return
+	}
+	_, _ = fmt.Fprintln(out, "\nDry run: the following files would be changed")
+	for _, change := range changes {
+		_, _ = fmt.Fprintln(out, change)
+	}
+}
+
 var cfgFile string
-var from string
-var allProjects, apply bool
-var additionalEnvs, projectIDs []string
+var from, organization, folder, projectFilter, clusterFilter, mergeInto string
+var concurrency int
+var allProjects, refresh, apply, watchConfig, force, wait, dryRun bool
+var additionalEnvs, projectIDs, accounts, gcloudConfigurations, clusterLabels, statuses, clusterIDs []string
 
 func init() {
 	generateCmd.Flags().StringVar(&cfgFile, "config", getDefaultConfigPath(), "config file")
 	generateCmd.Flags().StringVar(&from, "from", "file", "source from which the tmuxp config files are  generated")
 	generateCmd.Flags().BoolVar(&allProjects, "all-projects", false, "Skip confirmation for projects")
 	generateCmd.Flags().StringSliceVar(&projectIDs, "project-ids", nil, "Comma separated Project IDs to which the configurations need to be fetched")
+	generateCmd.Flags().StringVar(&organization, "organization", "", "ID of the organization whose projects, including the ones in its folders, are listed")
+	generateCmd.Flags().StringVar(&folder, "folder", "", "ID of the folder whose projects, including the ones in its subfolders, are listed")
+	generateCmd.Flags().StringVar(&projectFilter, "project-filter", "", "gcloud filter expression, like labels.env=prod, the listed projects should match")
+	generateCmd.Flags().StringSliceVar(&accounts, "accounts", nil, "Comma separated gcloud accounts whose projects are listed, instead of the active one")
+	generateCmd.Flags().StringSliceVar(&gcloudConfigurations, "gcloud-configurations", nil, "Comma separated gcloud configurations whose projects are listed, instead of the active one")
 	generateCmd.Flags().BoolVar(&apply, "apply", false, "Directly create the tmuxp configs for selected projects")
 	generateCmd.Flags().StringSliceVar(&additionalEnvs, "additional-envs", nil, "Additional envs to be populated")
+	generateCmd.Flags().StringVar(&clusterFilter, "cluster-filter", "", "Regular expression the names of the clusters to generate should match")
+	generateCmd.Flags().StringSliceVar(&clusterLabels, "cluster-labels", nil, "Comma separated key=value labels the clusters to generate should have")
+	generateCmd.Flags().StringSliceVar(&statuses, "status", nil, "Comma separated statuses, like RUNNING, one of which the clusters to generate should have")
+	generateCmd.Flags().StringSliceVar(&clusterIDs, "cluster-ids", nil, "Comma separated project/location/name of the clusters to generate instead of selecting them")
+	generateCmd.Flags().StringVar(&mergeInto, "merge-into", "", "Config file to add the discovered clusters to, keeping its contents, instead of printing a new config")
+	generateCmd.Flags().IntVar(&concurrency, "concurrency", 0, fmt.Sprintf("Maximum number of gcloud projects whose clusters are listed at once (default %d)", gcloud.DefaultConcurrency))
+	generateCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", gcloud.DefaultCacheTTL, "How long the listed gcloud projects and clusters are cached, 0 to not cache them")
+	generateCmd.Flags().BoolVar(&refresh, "refresh", false, "List the gcloud projects and clusters again instead of using the cached ones")
+	generateCmd.Flags().BoolVar(&force, "force", false, "Fetch kubeconfigs even if they are up to date")
+	generateCmd.Flags().BoolVar(&watchConfig, "watch", false, "Watch the config file and regenerate the clusters that change")
+	generateCmd.Flags().BoolVar(&wait, "wait", false, "Wait for other running kube-tmuxp commands to finish instead of failing")
+	generateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the file changes without applying them")
+	_ = generateCmd.RegisterFlagCompletionFunc("from", fixedCompletions(generator.Sources...))
+	_ = generateCmd.RegisterFlagCompletionFunc("project-ids", completeProjectIDs)
+	_ = generateCmd.RegisterFlagCompletionFunc("cluster-labels", completeClusterLabels)
+	_ = generateCmd.RegisterFlagCompletionFunc("cluster-ids", completeClusterIDs)
+	_ = generateCmd.RegisterFlagCompletionFunc("status", commaSeparatedCompletions(gcloud.ClusterStatuses...))
 	rootCmd.AddCommand(generateCmd)
 }
 
+// getDefaultConfigPath returns ~/.kube-tmuxp.yaml unless only
+// $XDG_CONFIG_HOME/kube-tmuxp/config.yaml exists
 func getDefaultConfigPath() string {
 	home, err := homedir.Dir()
 	if err != nil {
-		fmt.Println(err)
+		_, _ = fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	configFileName := ".kube-tmuxp.yaml"
-	return path.Join(home, configFileName)
+	defaultPath := path.Join(home, configFileName)
+
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfigHome == "" {
+		xdgConfigHome = path.Join(home, ".config")
+	}
+	xdgPath := path.Join(xdgConfigHome, "kube-tmuxp", "config.yaml")
+	if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
+		if _, err := os.Stat(xdgPath); err == nil {
+			return xdgPath
+		}
+	}
+	return defaultPath
 }
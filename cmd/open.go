@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+)
+
+var openCmd = &cobra.Command{
+	Use:               "open <context>",
+	Short:             "Starts or attaches to the tmux session of a context",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeContexts,
+	Run: func(cmd *cobra.Command, args []string) {
+		context := args[0]
+		fs := &filesystem.Default{}
+
+		kubetmuxpCfg, err := loadConfig(openCfgFile, fs, newCommander(logger))
+		if err != nil {
+			exitWithError(err)
+		}
+		tmuxpCfgFile, err := kubetmuxpCfg.TmuxpConfigFile(context)
+		if err != nil {
+			exitWithError(err)
+		}
+		if _, err := fs.Stat(tmuxpCfgFile); os.IsNotExist(err) {
+			exitWithError(fmt.Errorf("no tmuxp config for context %s: run kube-tmuxp gen to generate it", context))
+		}
+
+		logger.Debug("Loading tmuxp config", "file", tmuxpCfgFile)
+		tmuxp := exec.Command("tmuxp", "load", tmuxpCfgFile)
+		tmuxp.Stdin = os.Stdin
+		tmuxp.Stdout = os.Stdout
+		tmuxp.Stderr = os.Stderr
+		if err := tmuxp.Run(); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			exitWithError(err)
+		}
+	},
+}
+
+var openCfgFile string
+
+func init() {
+	openCmd.Flags().StringVar(&openCfgFile, "config", getDefaultConfigPath(), "config file")
+	rootCmd.AddCommand(openCmd)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <context>",
+	Short: "Rolls the kubeconfig of a context back to its previous version",
+	Args:  cobra.ExactArgs(1),
+	// completed with the contexts of the config and the tmuxp directory
+	ValidArgsFunction: completeContexts,
+	Run: func(cmd *cobra.Command, args []string) {
+		context := args[0]
+		fs := &filesystem.Default{}
+		cmdr := newCommander(logger)
+
+		kubetmuxpCfg, err := loadConfig(restoreCfgFile, fs, cmdr)
+		if err != nil {
+			exitWithError(err)
+		}
+		kubeCfg := kubetmuxpCfg.KubeConfig()
+
+		if restoreList {
+			backups, err := kubeCfg.Backups(context)
+			if err != nil {
+				exitWithError(err)
+			}
+			for _, backup := range backups {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), backup)
+			}
+			return
+		}
+
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+		l, err := kubeCfg.Lock(ctx, restoreWait)
+		if err != nil {
+			exitWithError(err)
+		}
+		defer l.Release()
+
+		backup, err := kubetmuxpCfg.Restore(context)
+		if err != nil {
+			exitWithError(err)
+		}
+		logger.Info("Restored context", "context", context, "backup", backup)
+	},
+}
+
+var restoreCfgFile string
+var restoreList, restoreWait bool
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreCfgFile, "config", getDefaultConfigPath(), "config file")
+	restoreCmd.Flags().BoolVar(&restoreList, "list", false, "List the backups of the context instead of restoring")
+	restoreCmd.Flags().BoolVar(&restoreWait, "wait", false, "Wait for other running kube-tmuxp commands to finish instead of failing")
+	rootCmd.AddCommand(restoreCmd)
+}
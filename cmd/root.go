@@ -1,22 +1,129 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "kube-tmuxp",
 	Short: `Tool to generate tmuxp configs that help to switch between multiple Kubernetes contexts safely`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		logger, err = newLogger(cmd.ErrOrStderr())
+		return err
+	},
+}
+
+var outputFlags kubetmuxp.Output
+var commandTimeout time.Duration
+var verbose, quiet bool
+var logFormat string
+
+// logger receives the progress of the commands, keeping it on stderr
+// apart from their machine readable output on stdout
+var logger *logging.Logger
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log debug messages, including every gcloud and kubectl command run")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Log only warnings and errors")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format: text or json")
+	_ = rootCmd.RegisterFlagCompletionFunc("log-format", fixedCompletions("text", "json"))
+	rootCmd.PersistentFlags().StringVar(&outputFlags.KubeconfigDir, "kubeconfig-dir", "", "Directory to store the kubeconfigs in (env KUBE_TMUXP_KUBECONFIG_DIR, default ~/.kube/configs)")
+	rootCmd.PersistentFlags().StringVar(&outputFlags.TmuxpDir, "tmuxp-dir", "", "Directory to store the tmuxp configs in (env KUBE_TMUXP_TMUXP_DIR, default is where tmuxp looks for configs)")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "command-timeout", 2*time.Minute, "Maximum time each gcloud and kubectl command may run, 0 for no limit")
+}
+
+// newLogger returns a Logger writing to out with the
+// level and format given through the flags
+func newLogger(out io.Writer) (*logging.Logger, error) {
+	if verbose && quiet {
+		return nil, fmt.Errorf("--verbose and --quiet cannot be used together")
+	}
+	format, err := logging.ParseFormat(logFormat)
+	if err != nil {
+		return nil, err
+	}
+	level := logging.InfoLevel
+	if verbose {
+		level = logging.DebugLevel
+	} else if quiet {
+		level = logging.WarnLevel
+	}
+	return logging.New(out, level, format), nil
+}
+
+// newCommander returns the Commander that runs gcloud and kubectl with
+// the timeout given through the flags, logging the commands to log
+func newCommander(log *logging.Logger) *commander.Default {
+	return &commander.Default{Timeout: commandTimeout, Log: log}
+}
+
+// exitWithError logs the error and exits with a non zero status
+func exitWithError(err error) {
+	logger.Error(err.Error())
+	os.Exit(1)
+}
+
+// interruptibleContext returns a context that is cancelled when
+// kube-tmuxp receives SIGINT or SIGTERM, stopping running commands
+func interruptibleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// loadConfig loads the config file, falling back to an empty config
+// if it does not exist, with the output directories overridden by the
+// flags. It is meant for commands that work on generated files alone.
+func loadConfig(cfgFile string, fs filesystem.FileSystem, cmdr commander.Commander) (kubetmuxp.Config, error) {
+	kubeCfg, err := kubeconfig.New(fs, cmdr)
+	if err != nil {
+		return kubetmuxp.Config{}, err
+	}
+	cfg, err := kubetmuxp.NewConfig(cfgFile, fs, kubeCfg, logger)
+	if os.IsNotExist(err) {
+		cfg, err = kubetmuxp.NewConfigWithProjects(nil, fs, kubeCfg, logger)
+	}
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.SetOutput(outputOverrides())
+}
+
+// outputOverrides returns the output directories given through
+// the flags or the environment, which take precedence over the
+// ones in the config file
+func outputOverrides() kubetmuxp.Output {
+	return outputFlags.Or(kubetmuxp.OutputFromEnv())
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		_, _ = fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
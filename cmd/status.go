@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/status"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Reports credential expiry and connectivity of the generated kubeconfigs",
+	Long: `Reports, for each context in the config, whether its kubeconfig exists and
+whether its credentials have expired or are about to expire. The expiry of
+gke-gcloud-auth-plugin credentials, fetched each time they are used, is
+reported as unknown.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fs := &filesystem.Default{}
+		cmdr := newCommander(logger)
+
+		kubeCfg, err := kubeconfig.New(fs, cmdr)
+		if err != nil {
+			exitWithError(err)
+		}
+		kubetmuxpCfg, err := kubetmuxp.NewConfig(statusCfgFile, fs, kubeCfg, logger)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := kubetmuxpCfg.SetOutput(outputOverrides()); err != nil {
+			exitWithError(err)
+		}
+
+		checker := status.NewChecker(kubetmuxpCfg.KubeConfig(), status.Options{
+			WarnWithin: statusWarnWithin,
+			Probe:      statusProbe,
+			Timeout:    statusTimeout,
+		})
+		statuses := checker.Check(context.Background(), kubetmuxpCfg.Contexts())
+
+		switch statusOutput {
+		case "text":
+			err = statuses.WriteText(cmd.OutOrStdout(), time.Now())
+		case "json":
+			err = statuses.WriteJSON(cmd.OutOrStdout())
+		default:
+			err = fmt.Errorf("invalid output format: valid formats are text,json")
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if !statuses.Healthy() {
+			os.Exit(1)
+		}
+	},
+}
+
+var statusCfgFile, statusOutput string
+var statusProbe bool
+var statusTimeout, statusWarnWithin time.Duration
+
+func init() {
+	statusCmd.Flags().StringVar(&statusCfgFile, "config", getDefaultConfigPath(), "config file")
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", "text", "output format: text or json")
+	statusCmd.Flags().BoolVar(&statusProbe, "probe", false, "Check whether the API server of each context answers /version")
+	statusCmd.Flags().DurationVar(&statusTimeout, "timeout", 5*time.Second, "Timeout for probing each API server")
+	statusCmd.Flags().DurationVar(&statusWarnWithin, "warn-within", time.Hour, "Mark credentials expiring within this duration as expiring")
+	_ = statusCmd.RegisterFlagCompletionFunc("output", fixedCompletions("text", "json"))
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/status"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/watch"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Keeps the credentials in the generated kubeconfigs fresh in the background",
+	Long: `Periodically checks the kubeconfigs of all the contexts in the config and
+re-fetches the ones that are missing, expired or about to expire.
+The gke-gcloud-auth-plugin credentials of the generated kubeconfigs have
+no known expiry, so those kubeconfigs are re-fetched only when missing.
+Runs in the foreground until it receives SIGINT or SIGTERM.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if watchInterval <= 0 {
+			exitWithError(fmt.Errorf("invalid interval %s: should be positive", watchInterval))
+		}
+		logFile, err := os.OpenFile(watchLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			exitWithError(err)
+		}
+		defer logFile.Close()
+		log, err := newLogger(logFile)
+		if err != nil {
+			exitWithError(err)
+		}
+		log = log.Timestamped()
+
+		pidFile, err := watch.AcquirePIDFile(watchPIDFile)
+		if err != nil {
+			exitWithError(err)
+		}
+		defer pidFile.Release()
+		// fail logs the error to the log file as well as to stderr and
+		// exits, releasing the pid file first as deferred calls do not run
+		fail := func(err error) {
+			log.Error(err.Error())
+			_ = pidFile.Release()
+			_ = logFile.Close()
+			exitWithError(err)
+		}
+
+		fs := &filesystem.Default{}
+		cmdr := newCommander(log)
+		kubeCfg, err := kubeconfig.New(fs, cmdr)
+		if err != nil {
+			fail(err)
+		}
+		kubetmuxpCfg, err := kubetmuxp.NewConfig(watchCfgFile, fs, kubeCfg, log)
+		if err != nil {
+			fail(err)
+		}
+		if err := kubetmuxpCfg.SetOutput(outputOverrides()); err != nil {
+			fail(err)
+		}
+		kubeCfg = kubetmuxpCfg.KubeConfig()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			log.Info("Received signal", "signal", sig)
+			cancel()
+			// a second signal kills the process if shutting down gets stuck
+			signal.Stop(signals)
+		}()
+
+		checker := status.NewChecker(kubeCfg, status.Options{WarnWithin: watchRefreshWithin})
+		refresher := lockedRefresher{config: &kubetmuxpCfg}
+		watcher := watch.New(checker, refresher, kubetmuxpCfg.Contexts(), watch.Options{
+			Interval: watchInterval,
+			Jitter:   watchJitter,
+		}, log)
+		if err := watcher.Run(ctx); err != nil {
+			fail(err)
+		}
+	},
+}
+
+// lockedRefresher refreshes contexts while holding the lock on the kube
+// configs, waiting for other kube-tmuxp commands to finish first
+type lockedRefresher struct {
+	config *kubetmuxp.Config
+}
+
+func (r lockedRefresher) Refresh(ctx context.Context, contexts []string) error {
+	kubeCfg := r.config.KubeConfig()
+	l, err := kubeCfg.Lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	// clusters are listed again for each refresh as their endpoints may have changed
+	r.config.SetClusterLookup(gcloud.NewClusterLookup(r.config.KubeConfig().Commander()))
+	return r.config.Refresh(ctx, contexts)
+}
+
+var watchCfgFile, watchPIDFile, watchLogFile string
+var watchInterval, watchJitter, watchRefreshWithin time.Duration
+
+func init() {
+	home, err := homedir.Dir()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	watchCmd.Flags().StringVar(&watchCfgFile, "config", getDefaultConfigPath(), "config file")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 5*time.Minute, "Time between two checks")
+	watchCmd.Flags().DurationVar(&watchJitter, "jitter", 30*time.Second, "Maximum random delay added to the interval")
+	watchCmd.Flags().DurationVar(&watchRefreshWithin, "refresh-within", 15*time.Minute, "Refresh credentials expiring within this duration")
+	watchCmd.Flags().StringVar(&watchPIDFile, "pid-file", path.Join(home, ".kube-tmuxp-watch.pid"), "File to store the pid of the watcher in")
+	watchCmd.Flags().StringVar(&watchLogFile, "log-file", path.Join(home, ".kube-tmuxp-watch.log"), "File to write the logs to")
+	rootCmd.AddCommand(watchCmd)
+}
@@ -1,29 +1,103 @@
 package commander
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 )
 
 // Commander is an interface to execute commands
 type Commander interface {
-	Execute(cmdStr string, args []string, envs []string) (string, error)
+	Execute(ctx context.Context, cmdStr string, args []string, envs []string) (string, error)
+}
+
+// Error is returned when a command cannot be started,
+// exits with a non zero status or times out
+type Error struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+	TimedOut bool
+	Timeout  time.Duration
+	Err      error
+}
+
+// Error returns the command line along with why it
+// failed and what the command wrote to its stderr
+func (e *Error) Error() string {
+	var msg string
+	switch {
+	case e.TimedOut && e.Timeout > 0:
+		msg = fmt.Sprintf("%s timed out after %s", e.Command, e.Timeout)
+	case e.TimedOut:
+		msg = fmt.Sprintf("%s timed out", e.Command)
+	case e.ExitCode > 0:
+		msg = fmt.Sprintf("%s exited with code %d", e.Command, e.ExitCode)
+	default:
+		msg = fmt.Sprintf("%s: %v", e.Command, e.Err)
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
 // Default is a Commander implementation that
 // can execute commands on a actual machine
-type Default struct{}
+type Default struct {
+	// Timeout limits how long each command may run, 0 means no limit
+	Timeout time.Duration
+	// Log receives every command executed at debug level
+	Log *logging.Logger
+}
 
 // Execute executes a command on the actual machine
-func (d *Default) Execute(cmdStr string, args []string, envs []string) (string, error) {
-	cmd := exec.Command(cmdStr, args...)
-	cmd.Stderr = os.Stderr
+func (d *Default) Execute(ctx context.Context, cmdStr string, args []string, envs []string) (string, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	command := strings.Join(append([]string{cmdStr}, args...), " ")
+	d.Log.Debug("Running command", "command", command, "envs", strings.Join(envs, " "))
+	start := time.Now()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, cmdStr, args...)
+	cmd.Stderr = &stderr
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, envs...)
 	out, err := cmd.Output()
 	if err != nil {
-		return string(out), err
+		cmdErr := &Error{
+			Command:  command,
+			ExitCode: -1,
+			Stderr:   stderr.String(),
+			Err:      err,
+		}
+		if ctx.Err() != nil {
+			cmdErr.Err = ctx.Err()
+			cmdErr.TimedOut = ctx.Err() == context.DeadlineExceeded
+			cmdErr.Timeout = d.Timeout
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			cmdErr.ExitCode = exitErr.ExitCode()
+		}
+		d.Log.Debug("Command failed", "command", command, "duration", time.Since(start), "error", cmdErr)
+		return string(out), cmdErr
 	}
 
+	d.Log.Debug("Command succeeded", "command", command, "duration", time.Since(start))
 	return string(out), nil
 }
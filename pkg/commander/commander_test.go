@@ -1,16 +1,21 @@
 package commander_test
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 )
 
 func TestExecute(t *testing.T) {
 	t.Run("should execute command on the machine", func(t *testing.T) {
 		cmdr := commander.Default{}
-		out, err := cmdr.Execute("echo", []string{"-n", "test"}, []string{})
+		out, err := cmdr.Execute(context.Background(), "echo", []string{"-n", "test"}, []string{})
 
 		assert.Nil(t, err)
 		assert.Equal(t, "test", out)
@@ -18,7 +23,7 @@ func TestExecute(t *testing.T) {
 
 	t.Run("should be able to set env variables for a command", func(t *testing.T) {
 		cmdr := commander.Default{}
-		out, err := cmdr.Execute("env", []string{}, []string{"TEST_ENV=test"})
+		out, err := cmdr.Execute(context.Background(), "env", []string{}, []string{"TEST_ENV=test"})
 
 		assert.Nil(t, err)
 		assert.Contains(t, out, "TEST_ENV=test")
@@ -26,9 +31,43 @@ func TestExecute(t *testing.T) {
 
 	t.Run("should return error if execution fails", func(t *testing.T) {
 		cmdr := commander.Default{}
-		out, err := cmdr.Execute("invalid-cmd", []string{}, []string{})
+		out, err := cmdr.Execute(context.Background(), "invalid-cmd", []string{}, []string{})
 
 		assert.NotNil(t, err)
 		assert.Equal(t, "", out)
 	})
+
+	t.Run("should return the exit code and stderr of a failed command", func(t *testing.T) {
+		cmdr := commander.Default{}
+		_, err := cmdr.Execute(context.Background(), "sh", []string{"-c", "echo 'ERROR: please login' >&2; exit 2"}, nil)
+
+		cmdErr, ok := err.(*commander.Error)
+		assert.True(t, ok)
+		assert.Equal(t, 2, cmdErr.ExitCode)
+		assert.Equal(t, "ERROR: please login\n", cmdErr.Stderr)
+		assert.EqualError(t, err, "sh -c echo 'ERROR: please login' >&2; exit 2 exited with code 2: ERROR: please login")
+	})
+
+	t.Run("should log the commands at debug level", func(t *testing.T) {
+		var log bytes.Buffer
+		cmdr := commander.Default{Log: logging.New(&log, logging.DebugLevel, logging.TextFormat)}
+		_, _ = cmdr.Execute(context.Background(), "echo", []string{"-n", "test"}, []string{"TEST_ENV=test"})
+		_, _ = cmdr.Execute(context.Background(), "sh", []string{"-c", "exit 3"}, nil)
+
+		lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+		assert.Len(t, lines, 4)
+		assert.Equal(t, `debug: Running command command="echo -n test" envs="TEST_ENV=test"`, lines[0])
+		assert.Regexp(t, `^debug: Command succeeded command="echo -n test" duration=\S+$`, lines[1])
+		assert.Regexp(t, `^debug: Command failed command="sh -c exit 3" duration=\S+ error="sh -c exit 3 exited with code 3"$`, lines[3])
+	})
+
+	t.Run("should stop commands that run longer than the timeout", func(t *testing.T) {
+		cmdr := commander.Default{Timeout: 50 * time.Millisecond}
+		_, err := cmdr.Execute(context.Background(), "sleep", []string{"5"}, nil)
+
+		cmdErr, ok := err.(*commander.Error)
+		assert.True(t, ok)
+		assert.True(t, cmdErr.TimedOut)
+		assert.EqualError(t, err, "sleep 5 timed out after 50ms")
+	})
 }
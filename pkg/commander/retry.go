@@ -0,0 +1,186 @@
+package commander
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+)
+
+// RetryPolicy configures how commands that fail with
+// transient errors are retried. Zero fields take the
+// values of DefaultRetryPolicy, except for an explicitly
+// set Jitter of zero that disables jitter.
+type RetryPolicy struct {
+	MaxAttempts    int            `yaml:"maxAttempts,omitempty"`
+	InitialBackoff time.Duration  `yaml:"initialBackoff,omitempty"`
+	MaxBackoff     time.Duration  `yaml:"maxBackoff,omitempty"`
+	Jitter         *time.Duration `yaml:"jitter,omitempty"`
+	ExitCodes      []int          `yaml:"exitCodes,omitempty"`
+	Patterns       []string       `yaml:"patterns,omitempty"`
+}
+
+var defaultJitter = time.Second
+
+// DefaultRetryPolicy retries commands that time out or whose stderr
+// tells about quota, rate limiting, server or network errors
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         &defaultJitter,
+	Patterns: []string{
+		`(?i)quota exceeded`,
+		`RESOURCE_EXHAUSTED`,
+		`(?i)rate ?limit`,
+		`code=(429|5\d\d)`,
+		`(?i)\b(503|service unavailable|internal error|backend error)\b`,
+		`(?i)connection (reset|refused|timed out)`,
+		`(?i)tls handshake timeout`,
+		`(?i)temporary failure in name resolution`,
+		`(?i)i/o timeout`,
+	},
+}
+
+// Or returns the policy with its zero fields taken from other
+func (p RetryPolicy) Or(other RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = other.MaxAttempts
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = other.InitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = other.MaxBackoff
+	}
+	if p.Jitter == nil {
+		p.Jitter = other.Jitter
+	}
+	if p.ExitCodes == nil {
+		p.ExitCodes = other.ExitCodes
+	}
+	if p.Patterns == nil {
+		p.Patterns = other.Patterns
+	}
+	return p
+}
+
+// Validate returns the problems with the policy
+func (p RetryPolicy) Validate() []string {
+	var problems []string
+	if p.MaxAttempts < 0 {
+		problems = append(problems, "retry: maxAttempts should not be negative")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 || (p.Jitter != nil && *p.Jitter < 0) {
+		problems = append(problems, "retry: durations should not be negative")
+	}
+	for _, pattern := range p.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("retry: invalid pattern %q: %v", pattern, err))
+		}
+	}
+	return problems
+}
+
+// Backoff returns the time to wait before the given retry, doubling
+// from the initial backoff up to the max backoff, without jitter
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// Retrying is a Commander that retries the commands of the base
+// Commander that fail with an error the policy deems transient
+type Retrying struct {
+	retries  int64 // first for 64-bit alignment of atomic accesses
+	base     Commander
+	policy   RetryPolicy
+	patterns []*regexp.Regexp
+	log      *logging.Logger
+}
+
+// NewRetrying creates a Retrying Commander that logs retries as warnings.
+// Wrapping a Retrying Commander replaces its policy.
+func NewRetrying(base Commander, policy RetryPolicy, log *logging.Logger) (*Retrying, error) {
+	if retrying, ok := base.(*Retrying); ok {
+		base = retrying.base
+	}
+	policy = policy.Or(DefaultRetryPolicy)
+	if problems := policy.Validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid retry policy: %s", problems[0])
+	}
+
+	r := &Retrying{base: base, policy: policy, log: log}
+	for _, pattern := range policy.Patterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	}
+	return r, nil
+}
+
+// Retries returns the number of times commands were retried
+func (r *Retrying) Retries() int {
+	return int(atomic.LoadInt64(&r.retries))
+}
+
+// Execute executes the command, retrying it with
+// exponential backoff while it fails transiently
+func (r *Retrying) Execute(ctx context.Context, cmdStr string, args []string, envs []string) (string, error) {
+	for attempt := 1; ; attempt++ {
+		out, err := r.base.Execute(ctx, cmdStr, args, envs)
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.retryable(err) {
+			return out, err
+		}
+
+		backoff := r.policy.Backoff(attempt)
+		if jitter := *r.policy.Jitter; jitter > 0 {
+			backoff += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		r.log.Warn("Retrying command", "backoff", backoff.Round(time.Millisecond), "attempt", attempt+1, "maxAttempts", r.policy.MaxAttempts, "error", err)
+		atomic.AddInt64(&r.retries, 1)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return out, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable tells if the command failed transiently: it timed out,
+// exited with one of the exit codes or wrote one of the patterns
+func (r *Retrying) retryable(err error) bool {
+	var cmdErr *Error
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	if cmdErr.TimedOut {
+		return true
+	}
+	if cmdErr.Err == context.Canceled {
+		return false
+	}
+	for _, code := range r.policy.ExitCodes {
+		if cmdErr.ExitCode == code {
+			return true
+		}
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(cmdErr.Stderr) {
+			return true
+		}
+	}
+	return false
+}
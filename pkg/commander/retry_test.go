@@ -0,0 +1,150 @@
+package commander_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+)
+
+var millisecond = time.Millisecond
+
+var fastPolicy = commander.RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Jitter: &millisecond}
+
+func quotaError() error {
+	return &commander.Error{Command: "gcloud container clusters list", ExitCode: 1, Stderr: "ERROR: (gcloud.container.clusters.list) ResponseError: code=429, message=Quota exceeded"}
+}
+
+func TestRetrying(t *testing.T) {
+	t.Run("should retry transient failures until the command succeeds", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCmdr := mock.NewCommander(ctrl)
+		gomock.InOrder(
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list"}, nil).Return("", quotaError()),
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list"}, nil).Return("", quotaError()),
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list"}, nil).Return("[]", nil),
+		)
+		var log bytes.Buffer
+		cmdr, err := commander.NewRetrying(mockCmdr, fastPolicy, logging.New(&log, logging.DebugLevel, logging.TextFormat))
+		assert.Nil(t, err)
+
+		out, err := cmdr.Execute(context.Background(), "gcloud", []string{"container", "clusters", "list"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "[]", out)
+		assert.Equal(t, 2, cmdr.Retries())
+		assert.Contains(t, log.String(), "warning: Retrying command backoff=")
+		assert.Contains(t, log.String(), `attempt=2 maxAttempts=3 error="gcloud container clusters list exited with code 1: ERROR:`)
+		assert.Contains(t, log.String(), "attempt=3 maxAttempts=3")
+	})
+
+	t.Run("should give up after the max attempts", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", nil, nil).Return("", quotaError()).Times(2)
+		policy := fastPolicy
+		policy.MaxAttempts = 2
+		cmdr, _ := commander.NewRetrying(mockCmdr, policy, nil)
+
+		_, err := cmdr.Execute(context.Background(), "gcloud", nil, nil)
+
+		assert.Equal(t, quotaError(), err)
+		assert.Equal(t, 1, cmdr.Retries())
+	})
+
+	t.Run("should not retry permanent failures", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", nil, nil).Return("", &commander.Error{Command: "gcloud", ExitCode: 1, Stderr: "ERROR: Not found"})
+		mockCmdr.EXPECT().Execute(gomock.Any(), "kubectl", nil, nil).Return("", fmt.Errorf("some error"))
+		cmdr, _ := commander.NewRetrying(mockCmdr, fastPolicy, nil)
+
+		_, gcloudErr := cmdr.Execute(context.Background(), "gcloud", nil, nil)
+		_, kubectlErr := cmdr.Execute(context.Background(), "kubectl", nil, nil)
+
+		assert.EqualError(t, gcloudErr, "gcloud exited with code 1: ERROR: Not found")
+		assert.EqualError(t, kubectlErr, "some error")
+		assert.Equal(t, 0, cmdr.Retries())
+	})
+
+	t.Run("should retry timeouts and the configured exit codes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCmdr := mock.NewCommander(ctrl)
+		gomock.InOrder(
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", nil, nil).Return("", &commander.Error{Command: "gcloud", ExitCode: -1, TimedOut: true}),
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", nil, nil).Return("", &commander.Error{Command: "gcloud", ExitCode: 75}),
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", nil, nil).Return("", nil),
+		)
+		policy := fastPolicy
+		policy.ExitCodes = []int{75}
+		cmdr, _ := commander.NewRetrying(mockCmdr, policy, nil)
+
+		_, err := cmdr.Execute(context.Background(), "gcloud", nil, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, cmdr.Retries())
+	})
+
+	t.Run("should stop waiting to retry when the context is done", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", nil, nil).Return("", quotaError())
+		cmdr, _ := commander.NewRetrying(mockCmdr, commander.RetryPolicy{InitialBackoff: time.Hour}, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := cmdr.Execute(ctx, "gcloud", nil, nil)
+
+		assert.Equal(t, quotaError(), err)
+	})
+
+	t.Run("should return error for an invalid policy", func(t *testing.T) {
+		_, err := commander.NewRetrying(nil, commander.RetryPolicy{Patterns: []string{"("}}, nil)
+
+		assert.EqualError(t, err, "invalid retry policy: retry: invalid pattern \"(\": error parsing regexp: missing closing ): `(`")
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := commander.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+}
+
+func TestRetryPolicyOr(t *testing.T) {
+	t.Run("should take the unset fields from the other policy", func(t *testing.T) {
+		policy := commander.RetryPolicy{MaxAttempts: 5}.Or(commander.DefaultRetryPolicy)
+
+		assert.Equal(t, 5, policy.MaxAttempts)
+		assert.Equal(t, time.Second, policy.InitialBackoff)
+		assert.Equal(t, time.Second, *policy.Jitter)
+	})
+
+	t.Run("should keep a jitter explicitly set to zero", func(t *testing.T) {
+		noJitter := time.Duration(0)
+
+		policy := commander.RetryPolicy{Jitter: &noJitter}.Or(commander.DefaultRetryPolicy)
+
+		assert.Equal(t, time.Duration(0), *policy.Jitter)
+	})
+}
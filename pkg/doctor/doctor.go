@@ -0,0 +1,268 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+// Status represents the outcome of a check
+type Status string
+
+// Possible outcomes of a check
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Result represents the outcome of a single check
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// Results represents the outcome of all the checks
+type Results []Result
+
+// HasFailures tells if any of the checks failed
+func (r Results) HasFailures() bool {
+	for _, result := range r {
+		if result.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the results in a human readable form
+func (r Results) WriteText(w io.Writer) error {
+	for _, result := range r {
+		if _, err := fmt.Fprintf(w, "[%s] %s: %s\n", result.Status, result.Name, result.Message); err != nil {
+			return err
+		}
+		if result.Hint != "" {
+			if _, err := fmt.Fprintf(w, "       hint: %s\n", result.Hint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the results as JSON
+func (r Results) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+type tool struct {
+	name     string
+	args     []string
+	required bool
+	hint     string
+}
+
+var tools = []tool{
+	{name: "gcloud", args: []string{"--version"}, required: true, hint: "install the Google Cloud SDK: https://cloud.google.com/sdk/docs/install"},
+	{name: "kubectl", args: []string{"version", "--client"}, required: true, hint: "install kubectl: gcloud components install kubectl"},
+	{name: "gke-gcloud-auth-plugin", args: []string{"--version"}, required: true, hint: "install the GKE auth plugin: gcloud components install gke-gcloud-auth-plugin"},
+	{name: "tmux", args: []string{"-V"}, required: true, hint: "install tmux: https://github.com/tmux/tmux/wiki/Installing"},
+	{name: "tmuxp", args: []string{"--version"}, required: true, hint: "install tmuxp: pip install --user tmuxp"},
+}
+
+// Doctor diagnoses the environment kube-tmuxp runs in
+type Doctor struct {
+	fs      filesystem.FileSystem
+	cmdr    commander.Commander
+	cfgFile string
+	output  kubetmuxp.Output
+}
+
+// New returns a new Doctor. The output directories of the config
+// are overridden by the non empty fields of output.
+func New(fs filesystem.FileSystem, cmdr commander.Commander, cfgFile string, output kubetmuxp.Output) Doctor {
+	return Doctor{fs: fs, cmdr: cmdr, cfgFile: cfgFile, output: output}
+}
+
+// Run runs all the checks
+func (d Doctor) Run(ctx context.Context) Results {
+	results := Results{}
+	gcloudFound := false
+	for _, t := range tools {
+		result := d.checkTool(ctx, t)
+		if t.name == "gcloud" {
+			gcloudFound = result.Status == Pass
+		}
+		results = append(results, result)
+	}
+
+	results = append(results, d.checkGcloudAuth(ctx, gcloudFound))
+	cfg, cfgErr := d.loadConfig()
+	results = append(results, d.checkOutputDirs(cfg)...)
+	results = append(results, d.checkConfig(cfg, cfgErr))
+	results = append(results, d.checkPermissions(cfg))
+	results = append(results, d.checkDirPermissions(cfg))
+	return results
+}
+
+func (d Doctor) checkTool(ctx context.Context, t tool) Result {
+	out, err := d.cmdr.Execute(ctx, t.name, t.args, nil)
+	if err != nil {
+		status := Warn
+		if t.required {
+			status = Fail
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return Result{Name: t.name, Status: status, Message: "not found in PATH", Hint: t.hint}
+		}
+		return Result{Name: t.name, Status: status, Message: fmt.Sprintf("error getting version: %v", err), Hint: t.hint}
+	}
+
+	return Result{Name: t.name, Status: Pass, Message: firstLine(out)}
+}
+
+func (d Doctor) checkGcloudAuth(ctx context.Context, gcloudFound bool) Result {
+	name := "gcloud auth"
+	if !gcloudFound {
+		return Result{Name: name, Status: Warn, Message: "skipped as gcloud is not available"}
+	}
+
+	out, err := d.cmdr.Execute(ctx, "gcloud", []string{"auth", "list", "--filter=status:ACTIVE", "--format=value(account)"}, nil)
+	if err != nil {
+		return Result{Name: name, Status: Fail, Message: fmt.Sprintf("error listing accounts: %v", err), Hint: "run: gcloud auth login"}
+	}
+	account := firstLine(out)
+	if account == "" {
+		return Result{Name: name, Status: Fail, Message: "no active account", Hint: "run: gcloud auth login"}
+	}
+
+	if _, err := d.cmdr.Execute(ctx, "gcloud", []string{"auth", "print-access-token"}, nil); err != nil {
+		return Result{Name: name, Status: Fail, Message: fmt.Sprintf("credentials for %s are invalid or expired", account), Hint: "run: gcloud auth login"}
+	}
+
+	return Result{Name: name, Status: Pass, Message: fmt.Sprintf("logged in as %s", account)}
+}
+
+// loadConfig loads the config and overrides its output directories. If
+// the config cannot be loaded, an empty config is returned along with
+// the error so that the default output directories can still be checked.
+func (d Doctor) loadConfig() (kubetmuxp.Config, error) {
+	kubeCfg, err := kubeconfig.New(d.fs, d.cmdr)
+	if err != nil {
+		return kubetmuxp.Config{}, err
+	}
+
+	cfg, err := kubetmuxp.NewConfig(d.cfgFile, d.fs, kubeCfg, nil)
+	if err != nil {
+		cfg, _ = kubetmuxp.NewConfigWithProjects(nil, d.fs, kubeCfg, nil)
+	}
+	if outputErr := cfg.SetOutput(d.output); outputErr != nil && err == nil {
+		err = outputErr
+	}
+	return cfg, err
+}
+
+func (d Doctor) checkOutputDirs(cfg kubetmuxp.Config) Results {
+	tmuxpCfgsDir, err := cfg.TmuxpDir()
+	if err != nil {
+		return Results{{Name: "output directories", Status: Fail, Message: fmt.Sprintf("error finding home directory: %v", err)}}
+	}
+
+	kubeCfg := cfg.KubeConfig()
+	return Results{
+		d.checkWritable("kubeconfig directory", kubeCfg.KubeCfgsDir()),
+		d.checkWritable("tmuxp directory", tmuxpCfgsDir),
+	}
+}
+
+func (d Doctor) checkWritable(name, dir string) Result {
+	probe := path.Join(dir, ".kube-tmuxp-doctor")
+	writer, err := d.fs.Create(probe)
+	if os.IsNotExist(err) {
+		return Result{Name: name, Status: Warn, Message: fmt.Sprintf("%s does not exist", dir), Hint: "it will be created by kube-tmuxp gen"}
+	}
+	if err != nil {
+		return Result{Name: name, Status: Fail, Message: fmt.Sprintf("%s is not writable: %v", dir, err), Hint: fmt.Sprintf("check the ownership and permissions of %s", dir)}
+	}
+	if closer, ok := writer.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	_ = d.fs.Remove(probe)
+
+	return Result{Name: name, Status: Pass, Message: fmt.Sprintf("%s is writable", dir)}
+}
+
+func (d Doctor) checkConfig(cfg kubetmuxp.Config, err error) Result {
+	name := "config"
+	if os.IsNotExist(err) {
+		return Result{Name: name, Status: Warn, Message: fmt.Sprintf("%s does not exist", d.cfgFile), Hint: "copy config.sample.yaml to get started or use kube-tmuxp gen --from gcloud"}
+	}
+	if err != nil {
+		return Result{Name: name, Status: Fail, Message: fmt.Sprintf("error reading %s: %v", d.cfgFile, err), Hint: "fix the YAML syntax of the config file"}
+	}
+	if err := cfg.Validate(); err != nil {
+		return Result{Name: name, Status: Fail, Message: err.Error(), Hint: "refer config.sample.yaml for the expected format"}
+	}
+
+	return Result{Name: name, Status: Pass, Message: fmt.Sprintf("%s is valid", d.cfgFile)}
+}
+
+func (d Doctor) checkPermissions(cfg kubetmuxp.Config) Result {
+	name := "kubeconfig permissions"
+	if runtime.GOOS == "windows" {
+		return Result{Name: name, Status: Pass, Message: "file permissions are not checked on windows"}
+	}
+
+	kubeCfg := cfg.KubeConfig()
+	var exposed []string
+	for _, context := range cfg.Contexts() {
+		backups, _ := kubeCfg.Backups(context)
+		for _, file := range append([]string{path.Join(kubeCfg.KubeCfgsDir(), context)}, backups...) {
+			if info, err := d.fs.Stat(file); err == nil && info.Mode().Perm()&0077 != 0 {
+				exposed = append(exposed, file)
+			}
+		}
+	}
+
+	if len(exposed) > 0 {
+		return Result{Name: name, Status: Warn, Message: fmt.Sprintf("readable by group or others: %s", strings.Join(exposed, ", ")), Hint: fmt.Sprintf("run: chmod 600 %s", strings.Join(exposed, " "))}
+	}
+	return Result{Name: name, Status: Pass, Message: "kubeconfigs are readable only by their owner"}
+}
+
+// checkDirPermissions warns about a kubeconfig directory accessible by
+// group or others, which kube-tmuxp leaves as it is when it is not the
+// default one
+func (d Doctor) checkDirPermissions(cfg kubetmuxp.Config) Result {
+	name := "kubeconfig directory permissions"
+	if runtime.GOOS == "windows" {
+		return Result{Name: name, Status: Pass, Message: "directory permissions are not checked on windows"}
+	}
+
+	kubeCfg := cfg.KubeConfig()
+	dir := kubeCfg.KubeCfgsDir()
+	if info, err := d.fs.Stat(dir); err == nil && info.Mode().Perm()&0077 != 0 {
+		return Result{Name: name, Status: Warn, Message: fmt.Sprintf("%s is accessible by group or others", dir), Hint: fmt.Sprintf("run: chmod 700 %s", dir)}
+	}
+	return Result{Name: name, Status: Pass, Message: fmt.Sprintf("%s is accessible only by its owner or does not exist", dir)}
+}
+
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(s), "\n", 2)[0])
+}
@@ -0,0 +1,297 @@
+package doctor_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/doctor"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+const validConfig = `
+projects:
+- name: test-project
+  clusters:
+  - name: test-cluster
+    zone: test-zone
+    context: test-ctx`
+
+type fileInfo struct {
+	os.FileInfo
+	name string
+	mode os.FileMode
+}
+
+func (f fileInfo) Name() string      { return f.name }
+func (f fileInfo) Mode() os.FileMode { return f.mode }
+
+type env struct {
+	missingTools  map[string]bool
+	activeAccount string
+	tokenErr      error
+	config        string
+	configErr     error
+}
+
+func setup(ctrl *gomock.Controller, e env) (*mock.FileSystem, *mock.Commander) {
+	mockFS := mock.NewFileSystem(ctrl)
+	mockCmdr := mock.NewCommander(ctrl)
+
+	versions := map[string][]string{
+		"gcloud":                 {"--version"},
+		"kubectl":                {"version", "--client"},
+		"gke-gcloud-auth-plugin": {"--version"},
+		"tmux":                   {"-V"},
+		"tmuxp":                  {"--version"},
+	}
+	for name, args := range versions {
+		if e.missingTools[name] {
+			mockCmdr.EXPECT().Execute(gomock.Any(), name, args, nil).Return("", &exec.Error{Name: name, Err: exec.ErrNotFound})
+		} else {
+			mockCmdr.EXPECT().Execute(gomock.Any(), name, args, nil).Return(fmt.Sprintf("%s 1.0.0\nmore details\n", name), nil)
+		}
+	}
+	if !e.missingTools["gcloud"] {
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"auth", "list", "--filter=status:ACTIVE", "--format=value(account)"}, nil).Return(e.activeAccount, nil)
+		if e.activeAccount != "" {
+			mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"auth", "print-access-token"}, nil).Return("token", e.tokenErr)
+		}
+	}
+
+	mockFS.EXPECT().HomeDir().Return("/Users/test", nil).AnyTimes()
+	mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+	for _, dir := range []string{"/Users/test/.kube/configs", "/Users/test/.tmuxp"} {
+		mockFS.EXPECT().Create(dir+"/.kube-tmuxp-doctor").Return(&bytes.Buffer{}, nil)
+		mockFS.EXPECT().Remove(dir + "/.kube-tmuxp-doctor").Return(nil)
+	}
+
+	mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(nil, &os.PathError{Op: "open", Err: os.ErrNotExist}).AnyTimes()
+	mockFS.EXPECT().Stat("/Users/test/.kube/configs/test-ctx").Return(fileInfo{name: "test-ctx", mode: 0600}, nil).AnyTimes()
+	mockFS.EXPECT().Stat("/Users/test/.kube/configs").Return(fileInfo{name: "configs", mode: os.ModeDir | 0700}, nil).AnyTimes()
+
+	if e.configErr != nil {
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(nil, e.configErr)
+	} else {
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(strings.NewReader(e.config), nil)
+	}
+	return mockFS, mockCmdr
+}
+
+func find(results doctor.Results, name string) doctor.Result {
+	for _, result := range results {
+		if result.Name == name {
+			return result
+		}
+	}
+	return doctor.Result{}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should pass all checks for a healthy environment", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{activeAccount: "user@example.com\n", config: validConfig})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		assert.False(t, results.HasFailures())
+		for _, result := range results {
+			assert.Equal(t, doctor.Pass, result.Status, result.Name)
+		}
+		assert.Equal(t, "tmuxp 1.0.0", find(results, "tmuxp").Message)
+		assert.Equal(t, "logged in as user@example.com", find(results, "gcloud auth").Message)
+	})
+
+	t.Run("should fail for missing required tools", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{
+			missingTools:  map[string]bool{"tmuxp": true, "gke-gcloud-auth-plugin": true},
+			activeAccount: "user@example.com",
+			config:        validConfig,
+		})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		assert.True(t, results.HasFailures())
+		tmuxp := find(results, "tmuxp")
+		assert.Equal(t, doctor.Fail, tmuxp.Status)
+		assert.Equal(t, "not found in PATH", tmuxp.Message)
+		assert.NotEmpty(t, tmuxp.Hint)
+		assert.Equal(t, doctor.Fail, find(results, "gke-gcloud-auth-plugin").Status)
+	})
+
+	t.Run("should skip auth check if gcloud is missing", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{missingTools: map[string]bool{"gcloud": true}, config: validConfig})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		assert.Equal(t, doctor.Warn, find(results, "gcloud auth").Status)
+	})
+
+	t.Run("should fail if there is no active gcloud account", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{config: validConfig})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		auth := find(results, "gcloud auth")
+		assert.Equal(t, doctor.Fail, auth.Status)
+		assert.Equal(t, "no active account", auth.Message)
+		assert.Equal(t, "run: gcloud auth login", auth.Hint)
+	})
+
+	t.Run("should fail if gcloud credentials have expired", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{activeAccount: "user@example.com", tokenErr: fmt.Errorf("exit status 1"), config: validConfig})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		auth := find(results, "gcloud auth")
+		assert.Equal(t, doctor.Fail, auth.Status)
+		assert.Equal(t, "credentials for user@example.com are invalid or expired", auth.Message)
+	})
+
+	t.Run("should warn if config file does not exist", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{activeAccount: "user@example.com", configErr: &os.PathError{Op: "open", Path: "kube-tmuxp-config.yaml", Err: os.ErrNotExist}})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		assert.Equal(t, doctor.Warn, find(results, "config").Status)
+		assert.False(t, results.HasFailures())
+	})
+
+	t.Run("should fail if config file is invalid", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockFS, mockCmdr := setup(ctrl, env{activeAccount: "user@example.com", config: `
+projects:
+- name: test-project
+  clusters:
+  - name: test-cluster
+    context: test-ctx`})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		config := find(results, "config")
+		assert.Equal(t, doctor.Fail, config.Status)
+		assert.Contains(t, config.Message, `project "test-project" cluster "test-cluster": exactly one of region or zone should be given`)
+	})
+}
+
+func TestCheckWritable(t *testing.T) {
+	t.Run("should warn if output directory does not exist and fail if it is not writable", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), nil).Return("", &exec.Error{Err: exec.ErrNotFound}).AnyTimes()
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil).AnyTimes()
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Create("/Users/test/.kube/configs/.kube-tmuxp-doctor").Return(nil, &os.PathError{Op: "open", Err: os.ErrNotExist})
+		mockFS.EXPECT().Create("/Users/test/.tmuxp/.kube-tmuxp-doctor").Return(nil, &os.PathError{Op: "open", Err: os.ErrPermission})
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(strings.NewReader(validConfig), nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(nil, &os.PathError{Op: "open", Err: os.ErrNotExist})
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/test-ctx").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+
+		results := doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background())
+
+		assert.Equal(t, doctor.Warn, find(results, "kubeconfig directory").Status)
+		assert.Equal(t, doctor.Fail, find(results, "tmuxp directory").Status)
+	})
+}
+
+func TestCheckPermissions(t *testing.T) {
+	t.Run("should warn about kubeconfigs and backups readable by group or others", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), nil).Return("", &exec.Error{Err: exec.ErrNotFound}).AnyTimes()
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil).AnyTimes()
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Create(gomock.Any()).Return(&bytes.Buffer{}, nil).Times(2)
+		mockFS.EXPECT().Remove(gomock.Any()).Return(nil).Times(2)
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(strings.NewReader(validConfig), nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return([]os.FileInfo{
+			fileInfo{name: "test-ctx.20200101T000000.000000000Z"},
+		}, nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/test-ctx").Return(fileInfo{name: "test-ctx", mode: 0600}, nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/.backups/test-ctx.20200101T000000.000000000Z").Return(fileInfo{mode: 0644}, nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs").Return(fileInfo{name: "configs", mode: os.ModeDir | 0700}, nil)
+
+		result := find(doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{}).Run(context.Background()), "kubeconfig permissions")
+
+		assert.Equal(t, doctor.Warn, result.Status)
+		assert.Equal(t, "readable by group or others: /Users/test/.kube/configs/.backups/test-ctx.20200101T000000.000000000Z", result.Message)
+		assert.Equal(t, "run: chmod 600 /Users/test/.kube/configs/.backups/test-ctx.20200101T000000.000000000Z", result.Hint)
+	})
+
+	t.Run("should warn about a kubeconfig directory accessible by group or others", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), gomock.Any(), gomock.Any(), nil).Return("", &exec.Error{Err: exec.ErrNotFound}).AnyTimes()
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil).AnyTimes()
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Create(gomock.Any()).Return(&bytes.Buffer{}, nil).Times(2)
+		mockFS.EXPECT().Remove(gomock.Any()).Return(nil).Times(2)
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(strings.NewReader(validConfig), nil)
+		mockFS.EXPECT().ReadDir("/data/kube/.backups").Return(nil, &os.PathError{Op: "open", Err: os.ErrNotExist})
+		mockFS.EXPECT().Stat("/data/kube/test-ctx").Return(fileInfo{name: "test-ctx", mode: 0600}, nil)
+		mockFS.EXPECT().Stat("/data/kube").Return(fileInfo{name: "kube", mode: os.ModeDir | 0755}, nil)
+
+		result := find(doctor.New(mockFS, mockCmdr, "kube-tmuxp-config.yaml", kubetmuxp.Output{KubeconfigDir: "/data/kube"}).Run(context.Background()), "kubeconfig directory permissions")
+
+		assert.Equal(t, doctor.Warn, result.Status)
+		assert.Equal(t, "/data/kube is accessible by group or others", result.Message)
+		assert.Equal(t, "run: chmod 700 /data/kube", result.Hint)
+	})
+}
+
+func TestResults(t *testing.T) {
+	results := doctor.Results{
+		{Name: "tmux", Status: doctor.Pass, Message: "tmux 3.0"},
+		{Name: "tmuxp", Status: doctor.Fail, Message: "not found in PATH", Hint: "install tmuxp"},
+	}
+
+	t.Run("should write results as text", func(t *testing.T) {
+		var out bytes.Buffer
+
+		err := results.WriteText(&out)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "[pass] tmux: tmux 3.0\n[fail] tmuxp: not found in PATH\n       hint: install tmuxp\n", out.String())
+	})
+
+	t.Run("should write results as json", func(t *testing.T) {
+		var out bytes.Buffer
+
+		err := results.WriteJSON(&out)
+
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[
+  {"name": "tmux", "status": "pass", "message": "tmux 3.0"},
+  {"name": "tmuxp", "status": "fail", "message": "not found in PATH", "hint": "install tmuxp"}
+]`, out.String())
+	})
+}
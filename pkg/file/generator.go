@@ -1,42 +1,84 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 )
 
+// Options configures the file generator
+type Options struct {
+	CfgFile string
+	Watch   bool
+	Force   bool
+	Wait    bool
+	DryRun  bool
+	Output  kubetmuxp.Output
+}
+
 type Generator struct {
+	options Options
 	fs      filesystem.FileSystem
 	cmdr    commander.Commander
-	cfgFile string
+	log     *logging.Logger
 }
 
-func NewGenerator(fs filesystem.FileSystem, cmdr commander.Commander, cfgFile string) Generator {
-	return Generator{fs: fs, cmdr: cmdr, cfgFile: cfgFile}
+func NewGenerator(options Options, fs filesystem.FileSystem, cmdr commander.Commander, log *logging.Logger) Generator {
+	return Generator{options: options, fs: fs, cmdr: cmdr, log: log}
 }
 
-func (g Generator) Generate(_, errStream io.Writer) {
+// Generate generates the kubeconfigs and tmuxp configs of the config file,
+// logging its progress. Nothing is written to out as the file generator
+// has no machine readable output.
+func (g Generator) Generate(ctx context.Context, out io.Writer) {
 	kubeCfg, err := kubeconfig.New(g.fs, g.cmdr)
 	if err != nil {
-		_, _ = fmt.Fprintf(errStream, err.Error())
+		g.log.Error(err.Error())
 		os.Exit(1)
 	}
 
-	fmt.Println("Using config file:", g.cfgFile)
-	kubetmuxpCfg, err := kubetmuxp.NewConfig(g.cfgFile, g.fs, kubeCfg)
+	g.log.Info("Using config file", "file", g.options.CfgFile)
+	kubetmuxpCfg, err := g.load(kubeCfg)
 	if err != nil {
-		_, _ = fmt.Fprintf(errStream, err.Error())
+		g.log.Error(err.Error())
 		os.Exit(1)
 	}
 
-	if err = kubetmuxpCfg.Process(); err != nil {
-		_, _ = fmt.Fprintf(errStream, err.Error())
+	target := kubetmuxpCfg.KubeConfig()
+	err = target.Locked(ctx, g.options.Wait, g.options.DryRun, func() error {
+		return kubetmuxpCfg.Process(ctx, g.options.Force)
+	})
+	if err != nil {
+		g.log.Error(err.Error())
 		os.Exit(1)
 	}
+
+	if g.options.Watch {
+		g.watchConfig(ctx, kubeCfg, kubetmuxpCfg)
+	}
+}
+
+// load reads and validates the config file, storing the kube configs
+// like base unless the config or the options give another directory
+func (g Generator) load(base kubeconfig.KubeConfig) (kubetmuxp.Config, error) {
+	cfg, err := kubetmuxp.NewConfig(g.options.CfgFile, g.fs, base, g.log)
+	if err != nil {
+		return cfg, fmt.Errorf("error reading %s: %v", g.options.CfgFile, err)
+	}
+	if err := cfg.SetOutput(g.options.Output); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	cfg.SetClusterLookup(gcloud.NewClusterLookup(cfg.KubeConfig().Commander()))
+	return cfg, nil
 }
@@ -0,0 +1,47 @@
+package file_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/file"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/golden"
+)
+
+func TestGenerate(t *testing.T) {
+	setup := func(t *testing.T) (*filesystem.Memory, *fakecli.CLI) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		config, err := ioutil.ReadFile("testdata/kube-tmuxp.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", config, 0644))
+		return fs, fakecli.New(fixture)
+	}
+
+	t.Run("should generate kubeconfigs and tmuxp configs for the clusters of the config", func(t *testing.T) {
+		fs, cli := setup(t)
+
+		file.NewGenerator(file.Options{CfgFile: "/home/test/.kube-tmuxp.yaml"}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+
+		golden.Assert(t, "testdata/generate.golden", golden.Tree(fs, "/home/test", "/home/test/.kube", "/home/test/.tmuxp"))
+		assert.Equal(t, []string{"gcloud container clusters list --project test-project --format=json"}, cli.Calls())
+	})
+
+	t.Run("should not fetch kubeconfigs again if the config did not change", func(t *testing.T) {
+		fs, cli := setup(t)
+		generator := file.NewGenerator(file.Options{CfgFile: "/home/test/.kube-tmuxp.yaml"}, fs, cli, nil)
+		generator.Generate(context.Background(), ioutil.Discard)
+		calls := len(cli.Calls())
+
+		generator.Generate(context.Background(), ioutil.Discard)
+
+		assert.Equal(t, 1, calls)
+		assert.Len(t, cli.Calls(), calls)
+		golden.Assert(t, "testdata/generate.golden", golden.Tree(fs, "/home/test", "/home/test/.kube", "/home/test/.tmuxp"))
+	})
+}
@@ -0,0 +1,127 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+const (
+	pollInterval = 500 * time.Millisecond
+	debounce     = time.Second
+)
+
+// digest returns a checksum of the contents of the given files.
+// Files that cannot be read contribute their error instead.
+func digest(fs filesystem.FileSystem, files []string) string {
+	hash := sha256.New()
+	for _, file := range files {
+		_, _ = fmt.Fprintf(hash, "%s\x00", file)
+		reader, err := fs.Open(file)
+		if err != nil {
+			_, _ = fmt.Fprintf(hash, "error: %v\x00", err)
+			continue
+		}
+		_, _ = io.Copy(hash, reader)
+		if closer, ok := reader.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// watchFiles polls the given files every interval and calls onChange once
+// their contents have stopped changing for the debounce duration
+func watchFiles(ctx context.Context, fs filesystem.FileSystem, files []string, interval, debounce time.Duration, onChange func()) {
+	last := digest(fs, files)
+	var changedAt time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if current := digest(fs, files); current != last {
+				last = current
+				changedAt = now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= debounce {
+				changedAt = time.Time{}
+				onChange()
+			}
+		}
+	}
+}
+
+// watchConfig regenerates the clusters that change whenever the config
+// file is saved, until ctx is done. The config is read again with base,
+// so that changes to its output and retry policy are used as well.
+func (g Generator) watchConfig(ctx context.Context, base kubeconfig.KubeConfig, current kubetmuxp.Config) {
+	g.log.Info("Watching config file for changes", "file", g.options.CfgFile)
+	watchFiles(ctx, g.fs, []string{g.options.CfgFile}, pollInterval, debounce, func() {
+		updated, err := g.load(base)
+		if err != nil {
+			g.log.Error(err.Error())
+			return
+		}
+		kubeCfg := updated.KubeConfig()
+		err = kubeCfg.Locked(ctx, g.options.Wait, g.options.DryRun, func() error {
+			return g.regenerate(ctx, current, updated)
+		})
+		if err != nil {
+			g.log.Error(err.Error())
+			return
+		}
+		current = updated
+	})
+}
+
+// regenerate processes only the clusters of the updated config that were
+// added or changed compared to the current config, fetching the kubeconfigs
+// of those whose definition changed. All the clusters are processed when
+// the output directories changed, as none were generated there yet.
+func (g Generator) regenerate(ctx context.Context, current, updated kubetmuxp.Config) error {
+	if updated.Output != current.Output {
+		g.log.Info("Output changed, generating all the clusters")
+		return updated.Process(ctx, false)
+	}
+
+	changes := kubetmuxp.Diff(current.Projects, updated.Projects)
+	if changes.Empty() {
+		g.log.Info("Config changed, but no clusters were affected")
+		return nil
+	}
+
+	g.log.Info("Config changed", changeFields(changes)...)
+	if err := updated.ProcessContexts(ctx, append(changes.Added, changes.Changed...), false); err != nil {
+		return err
+	}
+	if len(changes.Removed) > 0 {
+		g.log.Info("Generated files of removed contexts are left in place")
+	}
+	return nil
+}
+
+// changeFields returns the non empty lists of
+// changed contexts as key value pairs to log
+func changeFields(changes kubetmuxp.Changes) []interface{} {
+	var fields []interface{}
+	for _, change := range []struct {
+		key      string
+		contexts []string
+	}{{"added", changes.Added}, {"changed", changes.Changed}, {"removed", changes.Removed}} {
+		if len(change.contexts) > 0 {
+			fields = append(fields, change.key, change.contexts)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,225 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+)
+
+// privateDir is the info of a directory accessible only by its owner
+type privateDir string
+
+func (d privateDir) Name() string       { return string(d) }
+func (d privateDir) Size() int64        { return 0 }
+func (d privateDir) Mode() os.FileMode  { return os.ModeDir | 0700 }
+func (d privateDir) ModTime() time.Time { return time.Time{} }
+func (d privateDir) IsDir() bool        { return true }
+func (d privateDir) Sys() interface{}   { return nil }
+
+type content struct {
+	sync.Mutex
+	value string
+}
+
+func (c *content) set(value string) {
+	c.Lock()
+	defer c.Unlock()
+	c.value = value
+}
+
+func (c *content) reader(string) (*strings.Reader, error) {
+	c.Lock()
+	defer c.Unlock()
+	return strings.NewReader(c.value), nil
+}
+
+func TestWatchFiles(t *testing.T) {
+	t.Run("should call onChange once after rapid edits settle", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		cfg := &content{value: "v1"}
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().Open("config.yaml").DoAndReturn(cfg.reader).AnyTimes()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		changes := make(chan struct{}, 10)
+		done := make(chan struct{})
+		go func() {
+			watchFiles(ctx, mockFS, []string{"config.yaml"}, time.Millisecond, 50*time.Millisecond, func() { changes <- struct{}{} })
+			close(done)
+		}()
+
+		for i := 2; i <= 5; i++ {
+			cfg.set(fmt.Sprintf("v%d", i))
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("onChange was not called")
+		}
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		<-done
+		assert.Empty(t, changes)
+	})
+}
+
+func TestRegenerate(t *testing.T) {
+	current := kubetmuxp.Projects{
+		{
+			Name: "test-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "test-cluster", Zone: "test-zone", Context: "test-ctx"},
+			},
+		},
+	}
+
+	t.Run("should process only added and changed clusters", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockCmdr := mock.NewCommander(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil).Times(2)
+		mockFS.EXPECT().Open("config.yaml").Return(strings.NewReader(`
+projects:
+- name: test-project
+  clusters:
+  - name: test-cluster
+    zone: test-zone
+    context: test-ctx
+  - name: new-cluster
+    zone: test-zone
+    context: new-ctx`), nil)
+		mockFS.EXPECT().Open("/Users/test/.kube/configs/new-ctx").Return(nil, &os.PathError{Op: "open", Err: os.ErrNotExist})
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs").Return(privateDir("configs"), nil)
+		mockFS.EXPECT().TempDir("/Users/test/.kube/configs", ".kube-tmuxp-").Return("/Users/test/.kube/configs/.kube-tmuxp-1", nil)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json"}, nil).Return(`[{"name": "new-cluster", "location": "test-zone", "endpoint": "10.0.0.1"}]`, nil)
+		mockFS.EXPECT().Create("/Users/test/.kube/configs/.kube-tmuxp-1/new-ctx").Return(&bytes.Buffer{}, nil)
+		mockFS.EXPECT().Chmod("/Users/test/.kube/configs/.kube-tmuxp-1/new-ctx", os.FileMode(0600)).Return(nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/new-ctx").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Rename("/Users/test/.kube/configs/.kube-tmuxp-1/new-ctx", "/Users/test/.kube/configs/new-ctx").Return(nil)
+		mockFS.EXPECT().Remove("/Users/test/.kube/configs/.kube-tmuxp-1/new-ctx").Return(&os.PathError{Op: "remove", Err: os.ErrNotExist})
+		mockFS.EXPECT().Remove("/Users/test/.kube/configs/.kube-tmuxp-1").Return(nil)
+		mockFS.EXPECT().TempFile("/Users/test/.kube/configs", ".new-ctx.hash.tmp-").Return(&bytes.Buffer{}, "/Users/test/.kube/configs/.new-ctx.hash.tmp-1", nil)
+		mockFS.EXPECT().Rename("/Users/test/.kube/configs/.new-ctx.hash.tmp-1", "/Users/test/.kube/configs/.new-ctx.hash").Return(nil)
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().CreateDirIfNotExist("/Users/test/.tmuxp").Return(nil)
+		mockFS.EXPECT().TempFile("/Users/test/.tmuxp", ".new-ctx.yaml.tmp-").Return(&bytes.Buffer{}, "/Users/test/.tmuxp/.new-ctx.yaml.tmp-1", nil)
+		mockFS.EXPECT().Rename("/Users/test/.tmuxp/.new-ctx.yaml.tmp-1", "/Users/test/.tmuxp/new-ctx.yaml").Return(nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
+		currentCfg, _ := kubetmuxp.NewConfigWithProjects(current, mockFS, kubeCfg, nil)
+		var log bytes.Buffer
+		generator := NewGenerator(Options{CfgFile: "config.yaml", Watch: true}, mockFS, mockCmdr, logging.New(&log, logging.InfoLevel, logging.TextFormat))
+
+		updated, err := generator.load(kubeCfg)
+		assert.Nil(t, err)
+
+		err = generator.regenerate(context.Background(), currentCfg, updated)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"test-ctx", "new-ctx"}, updated.Contexts())
+		assert.Equal(t, `Config changed added=[new-ctx]
+Fetched kubeconfig cluster=new-cluster context=new-ctx file=/Users/test/.kube/configs/new-ctx
+`, log.String())
+	})
+
+	t.Run("should not fetch the kubeconfigs of clusters whose envs only changed", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		config, err := ioutil.ReadFile("testdata/kube-tmuxp.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", config, 0644))
+		cli := fakecli.New(fixture)
+		NewGenerator(Options{CfgFile: "/home/test/.kube-tmuxp.yaml"}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+		calls := len(cli.Calls())
+		kubeCfg, _ := kubeconfig.New(fs, cli)
+		currentCfg, err := kubetmuxp.NewConfig("/home/test/.kube-tmuxp.yaml", fs, kubeCfg, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", bytes.Replace(config, []byte("TEAM: platform"), []byte("TEAM: payments"), 1), 0644))
+		var log bytes.Buffer
+		generator := NewGenerator(Options{CfgFile: "/home/test/.kube-tmuxp.yaml", Watch: true}, fs, cli, logging.New(&log, logging.InfoLevel, logging.TextFormat))
+
+		updated, err := generator.load(kubeCfg)
+		assert.Nil(t, err)
+
+		err = generator.regenerate(context.Background(), currentCfg, updated)
+
+		assert.Nil(t, err)
+		assert.Len(t, cli.Calls(), calls)
+		assert.Equal(t, `Config changed changed=[zonal]
+Kubeconfig is up to date, skipping fetch cluster=zonal-cluster context=zonal
+`, log.String())
+		tmuxpConfig, err := fs.ReadFile("/home/test/.tmuxp/zonal.yaml")
+		assert.Nil(t, err)
+		assert.Contains(t, string(tmuxpConfig), "TEAM: payments\n")
+	})
+
+	t.Run("should generate all the clusters again when the output directories change", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		config, err := ioutil.ReadFile("testdata/kube-tmuxp.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", config, 0644))
+		cli := fakecli.New(fixture)
+		generator := NewGenerator(Options{CfgFile: "/home/test/.kube-tmuxp.yaml", Watch: true}, fs, cli, nil)
+		kubeCfg, _ := kubeconfig.New(fs, cli)
+		currentCfg, err := generator.load(kubeCfg)
+		assert.Nil(t, err)
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", append([]byte("output:\n  kubeconfigDir: ~/kube\n  tmuxpDir: ~/tmuxp\n"), config...), 0644))
+
+		updated, err := generator.load(kubeCfg)
+		assert.Nil(t, err)
+		err = generator.regenerate(context.Background(), currentCfg, updated)
+
+		assert.Nil(t, err)
+		updatedKubeCfg := updated.KubeConfig()
+		assert.Equal(t, "/home/test/kube/.kube-tmuxp.lock", updatedKubeCfg.LockFile())
+		for _, name := range updated.Contexts() {
+			_, err := fs.ReadFile("/home/test/kube/" + name)
+			assert.Nil(t, err)
+			_, err = fs.ReadFile("/home/test/tmuxp/" + name + ".yaml")
+			assert.Nil(t, err)
+		}
+	})
+
+	t.Run("should return error if the updated config is invalid", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().Open("config.yaml").Return(strings.NewReader(`
+projects:
+- name: test-project
+  clusters:
+  - name: test-cluster
+    context: test-ctx`), nil)
+		var log bytes.Buffer
+		generator := NewGenerator(Options{CfgFile: "config.yaml", Watch: true}, mockFS, nil, logging.New(&log, logging.InfoLevel, logging.TextFormat))
+
+		_, err := generator.load(kubeconfig.KubeConfig{})
+
+		assert.EqualError(t, err, "invalid config:\n project \"test-project\" cluster \"test-cluster\": exactly one of region or zone should be given")
+		assert.Empty(t, log.String())
+	})
+}
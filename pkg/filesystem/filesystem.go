@@ -1,10 +1,16 @@
 package filesystem
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/lock"
 )
 
 // FileSystem represents a filesystem
@@ -14,6 +20,19 @@ type FileSystem interface {
 	Open(file string) (io.Reader, error)
 	Create(file string) (io.Writer, error)
 	CreateDirIfNotExist(dir string) error
+	Rename(oldFile, newFile string) error
+	Stat(file string) (os.FileInfo, error)
+	EvalSymlinks(file string) (string, error)
+	Chmod(file string, mode os.FileMode) error
+	ReadDir(dir string) ([]os.FileInfo, error)
+	TempFile(dir, pattern string) (io.Writer, string, error)
+	TempDir(dir, pattern string) (string, error)
+	Lock(ctx context.Context, file string, wait bool) (Lock, error)
+}
+
+// Lock is a lock held on a file until it is released
+type Lock interface {
+	Release() error
 }
 
 // Default represents the Operating System's filesystem
@@ -57,10 +76,139 @@ func (d *Default) Create(file string) (io.Writer, error) {
 	return writer, nil
 }
 
-// CreateDirIfNotExist creates a new directory if it already exists
+// CreateDirIfNotExist creates a directory along with any
+// missing parents if it does not exist already
 func (d *Default) CreateDirIfNotExist(dir string) error {
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		return os.Mkdir(dir, 0755)
+	return os.MkdirAll(dir, 0755)
+}
+
+// Rename renames a file, replacing the new file if it already exists
+func (d *Default) Rename(oldFile, newFile string) error {
+	return os.Rename(oldFile, newFile)
+}
+
+// Stat returns the info of a file
+func (d *Default) Stat(file string) (os.FileInfo, error) {
+	return os.Stat(file)
+}
+
+// EvalSymlinks returns the file a path refers to after following its symlinks
+func (d *Default) EvalSymlinks(file string) (string, error) {
+	return filepath.EvalSymlinks(file)
+}
+
+// Chmod changes the permissions of a file
+func (d *Default) Chmod(file string, mode os.FileMode) error {
+	return os.Chmod(file, mode)
+}
+
+// ReadDir returns the info of the files in a directory sorted by name
+func (d *Default) ReadDir(dir string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dir)
+}
+
+// TempFile creates a new temporary file in the given directory
+// and returns it along with its name
+func (d *Default) TempFile(dir, pattern string) (io.Writer, string, error) {
+	file, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	return file, file.Name(), nil
+}
+
+// TempDir creates a new temporary directory in the given directory
+func (d *Default) TempDir(dir, pattern string) (string, error) {
+	return ioutil.TempDir(dir, pattern)
+}
+
+// Lock takes an advisory lock on the file, in an existing directory,
+// waiting for other processes to release it when wait is true
+func (d *Default) Lock(ctx context.Context, file string, wait bool) (Lock, error) {
+	l, err := lock.Acquire(ctx, file, wait)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// CreatePrivateDir creates a directory accessible only by the owner
+// along with any missing parents, and restricts an existing directory
+// with looser permissions to the owner. It is meant for the directories
+// that kube-tmuxp owns.
+func CreatePrivateDir(fs FileSystem, dir string) error {
+	return createPrivateDir(fs, dir, true)
+}
+
+// CreatePrivateDirIfNotExist creates a directory accessible only by
+// the owner along with any missing parents if it does not exist
+// already, leaving an existing directory as it is
+func CreatePrivateDirIfNotExist(fs FileSystem, dir string) error {
+	return createPrivateDir(fs, dir, false)
+}
+
+func createPrivateDir(fs FileSystem, dir string, restrict bool) error {
+	info, err := fs.Stat(dir)
+	if os.IsNotExist(err) {
+		if err := fs.CreateDirIfNotExist(dir); err != nil {
+			return err
+		}
+		return fs.Chmod(dir, 0700)
+	}
+	if err != nil {
+		return err
+	}
+	if restrict && info.Mode().Perm() != 0700 {
+		return fs.Chmod(dir, 0700)
+	}
+	return nil
+}
+
+// WriteFile writes data to a temporary file and renames it
+// to the given file so that readers never see partial content
+func WriteFile(fs FileSystem, file string, data []byte) error {
+	pattern := path.Base(file) + ".tmp-"
+	if !strings.HasPrefix(pattern, ".") {
+		pattern = "." + pattern
+	}
+	writer, tmpFile, err := fs.TempFile(path.Dir(file), pattern)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	if closer, ok := writer.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil {
+		err = fs.Rename(tmpFile, file)
+	}
+	if err != nil {
+		_ = fs.Remove(tmpFile)
+		return err
 	}
 	return nil
 }
+
+// ReplaceFile writes data to the file a path refers to, following its
+// symlinks, like WriteFile but keeping the permissions of the file when
+// it exists already
+func ReplaceFile(fs FileSystem, file string, data []byte) error {
+	target, err := fs.EvalSymlinks(file)
+	if os.IsNotExist(err) {
+		return WriteFile(fs, file, data)
+	}
+	if err != nil {
+		return err
+	}
+	info, err := fs.Stat(target)
+	if err != nil {
+		return err
+	}
+	if err := WriteFile(fs, target, data); err != nil {
+		return err
+	}
+	return fs.Chmod(target, info.Mode().Perm())
+}
@@ -0,0 +1,501 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/lock"
+)
+
+var (
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+	errNotEmpty = errors.New("directory not empty")
+)
+
+// Memory represents a filesystem held in memory. When it has a base
+// filesystem, the files that were not changed in memory are read from
+// the base, so that Memory stages the changes to the base without
+// applying them.
+type Memory struct {
+	mu      sync.Mutex
+	base    FileSystem
+	home    string
+	entries map[string]*entry
+	removed map[string]bool
+	locked  map[string]bool
+	seq     int
+}
+
+type entry struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemory returns an empty in-memory filesystem
+// with the given home directory
+func NewMemory(home string) *Memory {
+	m := &Memory{home: path.Clean(home), entries: map[string]*entry{}, removed: map[string]bool{}, locked: map[string]bool{}}
+	_ = m.CreateDirIfNotExist(m.home)
+	return m
+}
+
+// NewOverlay returns an in-memory filesystem that
+// reads the files it does not hold from base
+func NewOverlay(base FileSystem) (*Memory, error) {
+	home, err := base.HomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{base: base, home: home, entries: map[string]*entry{}, removed: map[string]bool{}, locked: map[string]bool{}}, nil
+}
+
+// Remove removes a file or an empty directory
+func (m *Memory) Remove(file string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file = path.Clean(file)
+	info, err := m.stat(file)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: file, Err: os.ErrNotExist}
+	}
+	if info.IsDir() {
+		if infos, _ := m.readDir(file); len(infos) > 0 {
+			return &os.PathError{Op: "remove", Path: file, Err: errNotEmpty}
+		}
+	}
+
+	delete(m.entries, file)
+	if m.base != nil {
+		m.removed[file] = true
+	}
+	return nil
+}
+
+// HomeDir returns the home directory
+func (m *Memory) HomeDir() (string, error) {
+	return m.home, nil
+}
+
+// Open opens a file for reading
+func (m *Memory) Open(file string) (io.Reader, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file = path.Clean(file)
+	if e, ok := m.entries[file]; ok {
+		if e.mode.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: file, Err: errIsDir}
+		}
+		return bytes.NewReader(append([]byte(nil), e.data...)), nil
+	}
+	if m.removed[file] || m.base == nil {
+		return nil, &os.PathError{Op: "open", Path: file, Err: os.ErrNotExist}
+	}
+	return m.base.Open(file)
+}
+
+// Create creates a new file or truncates it if it already exists
+func (m *Memory) Create(file string) (io.Writer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file = path.Clean(file)
+	mode := os.FileMode(0644)
+	if info, err := m.stat(file); err == nil {
+		if info.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: file, Err: errIsDir}
+		}
+		mode = info.Mode()
+	}
+	writer, err := m.create("open", file, mode)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// CreateDirIfNotExist creates a directory along with any
+// missing parents if it does not exist already
+func (m *Memory) CreateDirIfNotExist(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir = path.Clean(dir)
+	var missing []string
+	for current := dir; !isRoot(current); current = path.Dir(current) {
+		info, err := m.stat(current)
+		if err == nil {
+			if !info.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: current, Err: errNotDir}
+			}
+			break
+		}
+		missing = append(missing, current)
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		m.entries[missing[i]] = &entry{mode: os.ModeDir | 0755, modTime: time.Now()}
+		delete(m.removed, missing[i])
+	}
+	return nil
+}
+
+// Rename renames a file, replacing the new file if it already exists
+func (m *Memory) Rename(oldFile, newFile string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldFile, newFile = path.Clean(oldFile), path.Clean(newFile)
+	e, err := m.load(oldFile)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldFile, New: newFile, Err: os.ErrNotExist}
+	}
+	if !m.isDir(path.Dir(newFile)) {
+		return &os.LinkError{Op: "rename", Old: oldFile, New: newFile, Err: os.ErrNotExist}
+	}
+
+	if e.mode.IsDir() {
+		prefix := oldFile + "/"
+		for name, child := range m.entries {
+			if strings.HasPrefix(name, prefix) {
+				delete(m.entries, name)
+				m.entries[newFile+"/"+strings.TrimPrefix(name, prefix)] = child
+			}
+		}
+	}
+	delete(m.entries, oldFile)
+	if m.base != nil {
+		m.removed[oldFile] = true
+	}
+	m.entries[newFile] = e
+	delete(m.removed, newFile)
+	return nil
+}
+
+// Stat returns the info of a file
+func (m *Memory) Stat(file string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stat(path.Clean(file))
+}
+
+// EvalSymlinks returns the file a path refers to. Files held in memory
+// are never symlinks, while the other ones are resolved by the base
+// filesystem.
+func (m *Memory) EvalSymlinks(file string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file = path.Clean(file)
+	if _, ok := m.entries[file]; ok || isRoot(file) {
+		return file, nil
+	}
+	if m.removed[file] || m.base == nil {
+		return "", &os.PathError{Op: "lstat", Path: file, Err: os.ErrNotExist}
+	}
+	return m.base.EvalSymlinks(file)
+}
+
+// Chmod changes the permissions of a file
+func (m *Memory) Chmod(file string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file = path.Clean(file)
+	e, err := m.load(file)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: file, Err: os.ErrNotExist}
+	}
+	e.mode = e.mode&os.ModeType | mode.Perm()
+	m.entries[file] = e
+	return nil
+}
+
+// ReadDir returns the info of the files in a directory sorted by name
+func (m *Memory) ReadDir(dir string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir = path.Clean(dir)
+	if !m.isDir(dir) {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+	return m.readDir(dir)
+}
+
+// TempFile creates a new temporary file in the given directory
+// and returns it along with its name
+func (m *Memory) TempFile(dir, pattern string) (io.Writer, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file := m.tempName(dir, pattern)
+	writer, err := m.create("open", file, 0600)
+	if err != nil {
+		return nil, "", err
+	}
+	return writer, file, nil
+}
+
+// TempDir creates a new temporary directory in the given directory
+func (m *Memory) TempDir(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := m.tempName(dir, pattern)
+	if !m.isDir(path.Dir(name)) {
+		return "", &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+	}
+	m.entries[name] = &entry{mode: os.ModeDir | 0700, modTime: time.Now()}
+	delete(m.removed, name)
+	return name, nil
+}
+
+// Lock takes a lock on the file, in an existing directory, that is
+// held in memory only. It waits for the lock to be released when wait
+// is true, until ctx is done, and returns a lock.BusyError otherwise.
+func (m *Memory) Lock(ctx context.Context, file string, wait bool) (Lock, error) {
+	file = path.Clean(file)
+	for {
+		m.mu.Lock()
+		if !m.isDir(path.Dir(file)) {
+			m.mu.Unlock()
+			return nil, &os.PathError{Op: "open", Path: file, Err: os.ErrNotExist}
+		}
+		if !m.locked[file] {
+			m.locked[file] = true
+			m.mu.Unlock()
+			return memoryLock{m: m, file: file}, nil
+		}
+		m.mu.Unlock()
+		if !wait {
+			return nil, &lock.BusyError{PID: os.Getpid()}
+		}
+
+		timer := time.NewTimer(10 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// AddFile writes a file along with any missing parent directories
+func (m *Memory) AddFile(file string, data []byte, mode os.FileMode) error {
+	if err := m.CreateDirIfNotExist(path.Dir(file)); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writer, err := m.create("open", path.Clean(file), mode.Perm())
+	if err != nil {
+		return err
+	}
+	writer.e.data = append([]byte(nil), data...)
+	return nil
+}
+
+// ReadFile returns the contents of a file
+func (m *Memory) ReadFile(file string) ([]byte, error) {
+	reader, err := m.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// Entry represents a file or directory held in memory
+// or one that was removed from the base filesystem
+type Entry struct {
+	Path    string
+	Mode    os.FileMode
+	Data    []byte
+	Removed bool
+}
+
+// String returns a one line summary of the entry
+func (e Entry) String() string {
+	switch {
+	case e.Removed:
+		return fmt.Sprintf("- %s", e.Path)
+	case e.Mode.IsDir():
+		return fmt.Sprintf("+ %s/ (%04o)", e.Path, e.Mode.Perm())
+	default:
+		return fmt.Sprintf("+ %s (%04o, %d bytes)", e.Path, e.Mode.Perm(), len(e.Data))
+	}
+}
+
+// Snapshot returns the files and directories held in memory along
+// with the ones removed from the base filesystem, sorted by path
+func (m *Memory) Snapshot() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var snapshot []Entry
+	for name, e := range m.entries {
+		snapshot = append(snapshot, Entry{Path: name, Mode: e.mode, Data: append([]byte(nil), e.data...)})
+	}
+	for name := range m.removed {
+		if m.base == nil {
+			continue
+		}
+		if _, err := m.base.Stat(name); err == nil {
+			snapshot = append(snapshot, Entry{Path: name, Removed: true})
+		}
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Path < snapshot[j].Path })
+	return snapshot
+}
+
+type memoryWriter struct {
+	m *Memory
+	e *entry
+}
+
+func (w memoryWriter) Write(data []byte) (int, error) {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+
+	w.e.data = append(w.e.data, data...)
+	w.e.modTime = time.Now()
+	return len(data), nil
+}
+
+type memoryInfo struct {
+	name string
+	e    *entry
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return int64(len(i.e.data)) }
+func (i memoryInfo) Mode() os.FileMode  { return i.e.mode }
+func (i memoryInfo) ModTime() time.Time { return i.e.modTime }
+func (i memoryInfo) IsDir() bool        { return i.e.mode.IsDir() }
+func (i memoryInfo) Sys() interface{}   { return nil }
+
+type memoryLock struct {
+	m    *Memory
+	file string
+}
+
+func (l memoryLock) Release() error {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	delete(l.m.locked, l.file)
+	return nil
+}
+
+func isRoot(dir string) bool {
+	return dir == "/" || dir == "."
+}
+
+func (m *Memory) create(op, file string, mode os.FileMode) (memoryWriter, error) {
+	if !m.isDir(path.Dir(file)) {
+		return memoryWriter{}, &os.PathError{Op: op, Path: file, Err: os.ErrNotExist}
+	}
+	e := &entry{mode: mode.Perm(), modTime: time.Now()}
+	m.entries[file] = e
+	delete(m.removed, file)
+	return memoryWriter{m: m, e: e}, nil
+}
+
+func (m *Memory) stat(file string) (os.FileInfo, error) {
+	if isRoot(file) {
+		return memoryInfo{name: file, e: &entry{mode: os.ModeDir | 0755}}, nil
+	}
+	if e, ok := m.entries[file]; ok {
+		return memoryInfo{name: path.Base(file), e: e}, nil
+	}
+	if m.removed[file] || m.base == nil {
+		return nil, &os.PathError{Op: "stat", Path: file, Err: os.ErrNotExist}
+	}
+	return m.base.Stat(file)
+}
+
+func (m *Memory) isDir(dir string) bool {
+	info, err := m.stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// load returns the entry of a file, copying it from the
+// base filesystem if it is not held in memory yet
+func (m *Memory) load(file string) (*entry, error) {
+	if e, ok := m.entries[file]; ok {
+		return e, nil
+	}
+	info, err := m.stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{mode: info.Mode(), modTime: info.ModTime()}
+	if !info.IsDir() {
+		reader, err := m.base.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		if e.data, err = ioutil.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (m *Memory) readDir(dir string) ([]os.FileInfo, error) {
+	infos := map[string]os.FileInfo{}
+	if m.base != nil {
+		baseInfos, err := m.base.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, info := range baseInfos {
+			if !m.removed[path.Join(dir, info.Name())] {
+				infos[info.Name()] = info
+			}
+		}
+	}
+	for name, e := range m.entries {
+		if name != dir && path.Dir(name) == dir {
+			infos[path.Base(name)] = memoryInfo{name: path.Base(name), e: e}
+		}
+	}
+
+	var sorted []os.FileInfo
+	for _, info := range infos {
+		sorted = append(sorted, info)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name() < sorted[j].Name() })
+	return sorted, nil
+}
+
+func (m *Memory) tempName(dir, pattern string) string {
+	m.seq++
+	random := fmt.Sprintf("%d", m.seq)
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		return path.Join(dir, pattern[:i]+random+pattern[i+1:])
+	}
+	return path.Join(dir, pattern+random)
+}
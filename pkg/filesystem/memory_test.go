@@ -0,0 +1,200 @@
+package filesystem_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/lock"
+)
+
+var _ filesystem.FileSystem = &filesystem.Memory{}
+
+func TestMemory(t *testing.T) {
+	t.Run("should write and read files", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+
+		assert.Nil(t, fs.CreateDirIfNotExist("/Users/test/.kube/configs"))
+		writer, err := fs.Create("/Users/test/.kube/configs/test-ctx")
+		assert.Nil(t, err)
+		_, _ = writer.Write([]byte("kubeconfig"))
+
+		data, err := fs.ReadFile("/Users/test/.kube/configs/test-ctx")
+		assert.Nil(t, err)
+		assert.Equal(t, "kubeconfig", string(data))
+		info, _ := fs.Stat("/Users/test/.kube/configs")
+		assert.True(t, info.IsDir())
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	})
+
+	t.Run("should not create files in missing directories", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+
+		_, err := fs.Create("/Users/test/missing/file")
+
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("should write files atomically through temporary files", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+
+		err := filesystem.WriteFile(fs, "/Users/test/file", []byte("content"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []filesystem.Entry{
+			{Path: "/Users", Mode: os.ModeDir | 0755},
+			{Path: "/Users/test", Mode: os.ModeDir | 0755},
+			{Path: "/Users/test/file", Mode: 0600, Data: []byte("content")},
+		}, fs.Snapshot())
+	})
+
+	t.Run("should rename, chmod, list and remove files", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.AddFile("/Users/test/dir/b", []byte("b"), 0644))
+		assert.Nil(t, fs.AddFile("/Users/test/dir/a", []byte("a"), 0644))
+
+		assert.Nil(t, fs.Rename("/Users/test/dir/b", "/Users/test/dir/c"))
+		assert.Nil(t, fs.Chmod("/Users/test/dir/c", 0600))
+		infos, err := fs.ReadDir("/Users/test/dir")
+
+		assert.Nil(t, err)
+		assert.Len(t, infos, 2)
+		assert.Equal(t, "a", infos[0].Name())
+		assert.Equal(t, "c", infos[1].Name())
+		assert.Equal(t, os.FileMode(0600), infos[1].Mode())
+		assert.NotNil(t, fs.Remove("/Users/test/dir"))
+		assert.Nil(t, fs.Remove("/Users/test/dir/a"))
+		assert.Nil(t, fs.Remove("/Users/test/dir/c"))
+		assert.Nil(t, fs.Remove("/Users/test/dir"))
+		_, err = fs.Stat("/Users/test/dir")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("should create private directories and restrict existing ones", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.CreateDirIfNotExist("/Users/test/.kube/configs"))
+		assert.Nil(t, fs.Chmod("/Users/test/.kube/configs", 0755))
+
+		assert.Nil(t, filesystem.CreatePrivateDir(fs, "/Users/test/.kube/configs"))
+		assert.Nil(t, filesystem.CreatePrivateDir(fs, "/Users/test/.kube/configs/.backups"))
+
+		for _, dir := range []string{"/Users/test/.kube/configs", "/Users/test/.kube/configs/.backups"} {
+			info, err := fs.Stat(dir)
+			assert.Nil(t, err)
+			assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+		}
+	})
+
+	t.Run("should create private directories but leave existing ones as they are", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.CreateDirIfNotExist("/Users/test/kube"))
+
+		assert.Nil(t, filesystem.CreatePrivateDirIfNotExist(fs, "/Users/test/kube"))
+		assert.Nil(t, filesystem.CreatePrivateDirIfNotExist(fs, "/Users/test/data/kube"))
+
+		for dir, mode := range map[string]os.FileMode{"/Users/test/kube": 0755, "/Users/test/data": 0755, "/Users/test/data/kube": 0700} {
+			info, err := fs.Stat(dir)
+			assert.Nil(t, err)
+			assert.Equal(t, mode, info.Mode().Perm(), dir)
+		}
+	})
+
+	t.Run("should lock files in existing directories until they are released", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		l, err := fs.Lock(context.Background(), "/Users/test/test.lock", false)
+		assert.Nil(t, err)
+
+		_, err = fs.Lock(context.Background(), "/Users/test/test.lock", false)
+		assert.IsType(t, &lock.BusyError{}, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = fs.Lock(ctx, "/Users/test/test.lock", true)
+		assert.Equal(t, context.Canceled, err)
+
+		assert.Nil(t, l.Release())
+		l, err = fs.Lock(context.Background(), "/Users/test/test.lock", true)
+		assert.Nil(t, err)
+		assert.Nil(t, l.Release())
+		_, err = fs.Lock(context.Background(), "/Users/test/missing/test.lock", false)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("should stage changes to the base filesystem without applying them", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "kube-tmuxp-memory")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, "existing"), []byte("existing"), 0644))
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, "removed"), []byte("removed"), 0644))
+		fs, err := filesystem.NewOverlay(&filesystem.Default{})
+		assert.Nil(t, err)
+
+		assert.Nil(t, filesystem.WriteFile(fs, path.Join(dir, "existing"), []byte("changed")))
+		assert.Nil(t, fs.Remove(path.Join(dir, "removed")))
+		assert.Nil(t, fs.AddFile(path.Join(dir, "new", "file"), []byte("new"), 0600))
+
+		data, _ := fs.ReadFile(path.Join(dir, "existing"))
+		assert.Equal(t, "changed", string(data))
+		_, err = fs.Stat(path.Join(dir, "removed"))
+		assert.True(t, os.IsNotExist(err))
+		infos, _ := fs.ReadDir(dir)
+		assert.Len(t, infos, 2)
+		data, _ = ioutil.ReadFile(path.Join(dir, "existing"))
+		assert.Equal(t, "existing", string(data))
+		_, err = os.Stat(path.Join(dir, "removed"))
+		assert.Nil(t, err)
+		assert.Equal(t, []filesystem.Entry{
+			{Path: path.Join(dir, "existing"), Mode: 0600, Data: []byte("changed")},
+			{Path: path.Join(dir, "new"), Mode: os.ModeDir | 0755},
+			{Path: path.Join(dir, "new", "file"), Mode: 0600, Data: []byte("new")},
+			{Path: path.Join(dir, "removed"), Removed: true},
+		}, fs.Snapshot())
+	})
+}
+
+func TestReplaceFile(t *testing.T) {
+	t.Run("should keep the permissions of an existing file", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.AddFile("/Users/test/config.yaml", []byte("old"), 0644))
+
+		assert.Nil(t, filesystem.ReplaceFile(fs, "/Users/test/config.yaml", []byte("new")))
+
+		data, _ := fs.ReadFile("/Users/test/config.yaml")
+		assert.Equal(t, "new", string(data))
+		info, _ := fs.Stat("/Users/test/config.yaml")
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	})
+
+	t.Run("should create a missing file readable only by its owner", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+
+		assert.Nil(t, filesystem.ReplaceFile(fs, "/Users/test/config.yaml", []byte("new")))
+
+		info, _ := fs.Stat("/Users/test/config.yaml")
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("should write to the target of a symlink and keep the symlink", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "kube-tmuxp-replace")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		target := path.Join(dir, "dotfiles", "config.yaml")
+		link := path.Join(dir, "config.yaml")
+		assert.Nil(t, os.Mkdir(path.Join(dir, "dotfiles"), 0755))
+		assert.Nil(t, ioutil.WriteFile(target, []byte("old"), 0644))
+		assert.Nil(t, os.Symlink(target, link))
+
+		assert.Nil(t, filesystem.ReplaceFile(&filesystem.Default{}, link, []byte("new")))
+
+		info, err := os.Lstat(link)
+		assert.Nil(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode()&os.ModeSymlink)
+		data, _ := ioutil.ReadFile(target)
+		assert.Equal(t, "new", string(data))
+		info, _ = os.Stat(target)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	})
+}
@@ -0,0 +1,212 @@
+package gcloud
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+)
+
+// DefaultCacheTTL is how long the listed projects and clusters are reused
+const DefaultCacheTTL = time.Hour
+
+// cachedCommands are the read only gcloud commands whose output is cached
+var cachedCommands = []string{
+	"projects list",
+	"resource-manager folders list",
+	"container clusters list",
+}
+
+// Cache stores the output of the gcloud commands listing projects,
+// folders and clusters on disk, keyed by the active account and the
+// command, so that they are not run again until their output expires
+type Cache struct {
+	dir string
+	fs  filesystem.FileSystem
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewCache creates a Cache in dir whose entries expire after ttl
+func NewCache(dir string, fs filesystem.FileSystem, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, fs: fs, ttl: ttl, now: time.Now}
+}
+
+// DefaultCacheDir returns the directory of the cache in the user cache dir
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "kube-tmuxp", "gcloud"), nil
+}
+
+// Dir returns the directory of the cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Clear removes all the entries of the cache and returns how many there were
+func (c *Cache) Clear() (int, error) {
+	infos, err := c.fs.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, info := range infos {
+		if info.IsDir() || path.Ext(info.Name()) != ".json" {
+			continue
+		}
+		if err := c.fs.Remove(path.Join(c.dir, info.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Commander returns a Commander running the commands with base and
+// caching the output of the ones listing projects, folders and clusters.
+// When refreshing, the cached output is ignored but replaced.
+func (c *Cache) Commander(base commander.Commander, refresh bool, log *logging.Logger) commander.Commander {
+	if c.ttl <= 0 {
+		return base
+	}
+	return &cachingCommander{cache: c, base: base, refresh: refresh, log: log, accounts: map[string]string{}}
+}
+
+// cacheEntry is the cached output of a command
+type cacheEntry struct {
+	Account string    `json:"account"`
+	Command string    `json:"command"`
+	SavedAt time.Time `json:"savedAt"`
+	Output  string    `json:"output"`
+}
+
+func (c *Cache) file(account, command string, envs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{account, command}, envs...), "\n")))
+	return path.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *Cache) load(file string) (cacheEntry, bool) {
+	reader, err := c.fs.Open(file)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	data, err := ioutil.ReadAll(reader)
+	if closer, ok := reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	var entry cacheEntry
+	if err != nil || json.Unmarshal(data, &entry) != nil {
+		return cacheEntry{}, false
+	}
+	return entry, c.now().Sub(entry.SavedAt) < c.ttl
+}
+
+func (c *Cache) save(file string, entry cacheEntry) error {
+	if err := filesystem.CreatePrivateDir(c.fs, c.dir); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFile(c.fs, file, data)
+}
+
+type cachingCommander struct {
+	cache   *Cache
+	base    commander.Commander
+	refresh bool
+	log     *logging.Logger
+
+	mu       sync.Mutex
+	accounts map[string]string
+}
+
+// Execute returns the cached output of the command if it has not
+// expired, or else executes it and caches its output if it succeeds
+func (c *cachingCommander) Execute(ctx context.Context, cmdStr string, args []string, envs []string) (string, error) {
+	command := strings.Join(append([]string{cmdStr}, args...), " ")
+	if !cacheable(cmdStr, args) {
+		return c.base.Execute(ctx, cmdStr, args, envs)
+	}
+	account, err := c.account(ctx, envs)
+	if err != nil {
+		c.log.Debug("Not caching command as the gcloud account is unknown", "command", command, "error", err)
+		return c.base.Execute(ctx, cmdStr, args, envs)
+	}
+
+	file := c.cache.file(account, command, envs)
+	if !c.refresh {
+		if entry, ok := c.cache.load(file); ok {
+			c.log.Debug("Using cached output", "command", command, "age", c.cache.now().Sub(entry.SavedAt).Round(time.Second))
+			return entry.Output, nil
+		}
+	}
+	out, err := c.base.Execute(ctx, cmdStr, args, envs)
+	if err != nil {
+		return out, err
+	}
+	entry := cacheEntry{Account: account, Command: command, SavedAt: c.cache.now(), Output: out}
+	if err := c.cache.save(file, entry); err != nil {
+		c.log.Debug("Cannot cache output", "command", command, "error", err)
+	}
+	return out, nil
+}
+
+// Retries returns the number of times the base Commander retried
+// commands, so that wrapping a Retrying Commander keeps its count
+func (c *cachingCommander) Retries() int {
+	if counter, ok := c.base.(interface{ Retries() int }); ok {
+		return counter.Retries()
+	}
+	return 0
+}
+
+// account returns the gcloud account the commands run with given envs
+// use, asking gcloud at most once per envs
+func (c *cachingCommander) account(ctx context.Context, envs []string) (string, error) {
+	key := strings.Join(envs, "\n")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if account, ok := c.accounts[key]; ok {
+		return account, nil
+	}
+	out, err := c.base.Execute(ctx, "gcloud", []string{"config", "get-value", "account"}, envs)
+	if err != nil {
+		return "", err
+	}
+	account := strings.TrimSpace(out)
+	c.accounts[key] = account
+	return account, nil
+}
+
+func cacheable(cmdStr string, args []string) bool {
+	if cmdStr != "gcloud" {
+		return false
+	}
+	command := strings.Join(args, " ")
+	for _, prefix := range cachedCommands {
+		if strings.HasPrefix(command, prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
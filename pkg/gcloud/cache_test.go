@@ -0,0 +1,156 @@
+package gcloud
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+)
+
+func newTestCache(fs filesystem.FileSystem, now *time.Time) *Cache {
+	cache := NewCache("/home/test/.cache/kube-tmuxp/gcloud", fs, time.Hour)
+	cache.now = func() time.Time { return *now }
+	return cache
+}
+
+func TestCache(t *testing.T) {
+	fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+	assert.Nil(t, err)
+	fixture.Account = "test@example.com"
+	listClusters := []string{"container", "clusters", "list", "--project", "test-project", "--format=json"}
+
+	t.Run("should reuse the output of listing commands until it expires", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		cache := newTestCache(fs, &now)
+		cli := fakecli.New(fixture)
+		cmdr := cache.Commander(cli, false, nil)
+
+		first, err := cmdr.Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+		now = now.Add(59 * time.Minute)
+		second, err := cmdr.Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+		_, err = cache.Commander(cli, false, nil).Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+
+		assert.Equal(t, first, second)
+		assert.Equal(t, []string{
+			"gcloud config get-value account",
+			"gcloud container clusters list --project test-project --format=json",
+			"gcloud config get-value account",
+		}, cli.Calls())
+
+		now = now.Add(time.Minute)
+		_, err = cmdr.Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "gcloud container clusters list --project test-project --format=json", cli.Calls()[3])
+		entries, err := fs.ReadDir(cache.Dir())
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, os.FileMode(0600), entries[0].Mode().Perm())
+	})
+
+	t.Run("should replace the cached output when refreshing", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		cache := newTestCache(fs, &now)
+		cli := fakecli.New(fixture)
+
+		_, err := cache.Commander(cli, false, nil).Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+		_, err = cache.Commander(cli, true, nil).Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{
+			"gcloud config get-value account",
+			"gcloud container clusters list --project test-project --format=json",
+			"gcloud config get-value account",
+			"gcloud container clusters list --project test-project --format=json",
+		}, cli.Calls())
+		infos, err := fs.ReadDir(cache.Dir())
+		assert.Nil(t, err)
+		assert.Len(t, infos, 1)
+	})
+
+	t.Run("should cache the output of each account apart", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		cache := newTestCache(fs, &now)
+		other := fixture
+		other.Account = "other@example.com"
+		cli := fakecli.New(other)
+
+		_, err := cache.Commander(fakecli.New(fixture), false, nil).Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+		_, err = cache.Commander(cli, false, nil).Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{
+			"gcloud config get-value account",
+			"gcloud container clusters list --project test-project --format=json",
+		}, cli.Calls())
+	})
+
+	t.Run("should not cache other commands or failures", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		cache := newTestCache(fs, &now)
+		cmdr := cache.Commander(fakecli.New(fixture), false, nil)
+
+		_, err := cmdr.Execute(context.Background(), "gcloud", []string{"container", "clusters", "list", "--project", "unknown", "--format=json"}, nil)
+		assert.NotNil(t, err)
+		_, err = cmdr.Execute(context.Background(), "kubectl", []string{"get", "pods"}, nil)
+		assert.NotNil(t, err)
+
+		_, err = fs.ReadDir(cache.Dir())
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("should clear the cached output", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		cache := newTestCache(fs, &now)
+		cmdr := cache.Commander(fakecli.New(fixture), false, nil)
+		_, err := cmdr.Execute(context.Background(), "gcloud", []string{"projects", "list", "--format=json"}, nil)
+		assert.Nil(t, err)
+		_, err = cmdr.Execute(context.Background(), "gcloud", listClusters, nil)
+		assert.Nil(t, err)
+
+		removed, err := cache.Clear()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, removed)
+
+		removed, err = NewCache("/home/test/missing", fs, time.Hour).Clear()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, removed)
+	})
+
+	t.Run("should count the retries of the commander it wraps", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockCmdr := mock.NewCommander(ctrl)
+		gomock.InOrder(
+			mockCmdr.EXPECT().Execute(gomock.Any(), "kubectl", []string{"get", "pods"}, nil).Return("", &commander.Error{Command: "kubectl get pods", ExitCode: 1, Stderr: "connection refused"}),
+			mockCmdr.EXPECT().Execute(gomock.Any(), "kubectl", []string{"get", "pods"}, nil).Return("", nil),
+		)
+		jitter := time.Duration(0)
+		retrying, err := commander.NewRetrying(mockCmdr, commander.RetryPolicy{InitialBackoff: time.Millisecond, Jitter: &jitter}, nil)
+		assert.Nil(t, err)
+		now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+		cmdr := newTestCache(filesystem.NewMemory("/home/test"), &now).Commander(retrying, false, nil)
+
+		_, err = cmdr.Execute(context.Background(), "kubectl", []string{"get", "pods"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, cmdr.(interface{ Retries() int }).Retries())
+	})
+}
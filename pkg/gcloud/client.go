@@ -1,24 +1,30 @@
 package gcloud
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
 )
 
 // ListProjects lists the projects for logged-in user
-func ListProjects(commander commander.Commander) (Projects, error) {
+// that match the gcloud filter expression, if any
+func ListProjects(ctx context.Context, commander commander.Commander, filter string) (Projects, error) {
 	args := []string{
 		"projects",
 		"list",
 		"--format=json",
 	}
-	response, err := commander.Execute("gcloud", args, nil)
+	if filter != "" {
+		args = append(args, "--filter="+filter)
+	}
+	response, err := commander.Execute(ctx, "gcloud", args, nil)
 	fullCommand := strings.Join(append([]string{"gcloud"}, args...), " ")
 	if err != nil {
-		return nil, fmt.Errorf("error executing %s: %v", fullCommand, err)
+		return nil, fmt.Errorf("error listing projects: %w", err)
 	}
 	var projects []Project
 	err = json.Unmarshal([]byte(response), &projects)
@@ -31,7 +37,35 @@ func ListProjects(commander commander.Commander) (Projects, error) {
 
 // Project represent the GCP project
 type Project struct {
-	ProjectId string `json:"projectId"`
+	ProjectId string            `json:"projectId"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	// Identity is the identity the project was listed with
+	Identity Identity `json:"-"`
+}
+
+// Description describes the project by its ID along with its name,
+// labels and the identity it was listed with when it has them
+func (p Project) Description() string {
+	description := p.ProjectId
+	if p.Name != "" && p.Name != p.ProjectId {
+		description += fmt.Sprintf(" (%s)", p.Name)
+	}
+	if len(p.Labels) > 0 {
+		labels := make([]string, 0, len(p.Labels))
+		for key, value := range p.Labels {
+			labels = append(labels, fmt.Sprintf("%s=%s", key, value))
+		}
+		sort.Strings(labels)
+		description += " " + strings.Join(labels, ",")
+	}
+	if p.Identity.Account != "" {
+		description += " as " + p.Identity.Account
+	}
+	if p.Identity.Configuration != "" {
+		description += " with configuration " + p.Identity.Configuration
+	}
+	return description
 }
 
 // Projects represent the list of GCP projects
@@ -59,11 +93,80 @@ func (p Projects) Filter(projectIDs []string) Projects {
 	return result
 }
 
+// Folder represents a GCP folder, named folders/<id>
+type Folder struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Parent      string `json:"parent"`
+}
+
+// ID returns the numeric ID of the folder
+func (f Folder) ID() string {
+	return strings.TrimPrefix(f.Name, "folders/")
+}
+
+// ListFolders lists the folders directly in the given
+// parent, either organizations/<id> or folders/<id>
+func ListFolders(ctx context.Context, cmdr commander.Commander, parent string) ([]Folder, error) {
+	parts := strings.SplitN(parent, "/", 2)
+	if len(parts) != 2 || (parts[0] != "organizations" && parts[0] != "folders") {
+		return nil, fmt.Errorf("invalid folder parent %s: should be organizations/<id> or folders/<id>", parent)
+	}
+	args := []string{
+		"resource-manager",
+		"folders",
+		"list",
+		fmt.Sprintf("--%s=%s", strings.TrimSuffix(parts[0], "s"), parts[1]),
+		"--format=json",
+	}
+	response, err := cmdr.Execute(ctx, "gcloud", args, nil)
+	fullCommand := strings.Join(append([]string{"gcloud"}, args...), " ")
+	if err != nil {
+		return nil, fmt.Errorf("error listing folders of %s: %w", parent, err)
+	}
+	var folders []Folder
+	err = json.Unmarshal([]byte(response), &folders)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling the response from command %s: %v", fullCommand, err)
+	}
+
+	return folders, nil
+}
+
 // Cluster represent the GKE Cluster
 type Cluster struct {
-	Name      string
-	Location  string
-	Locations []string
+	Name                        string
+	Location                    string
+	Locations                   []string
+	Endpoint                    string
+	MasterAuth                  MasterAuth
+	Status                      string
+	ResourceLabels              map[string]string
+	PrivateClusterConfig        PrivateClusterConfig
+	ControlPlaneEndpointsConfig ControlPlaneEndpointsConfig
+}
+
+// MasterAuth represents how clients authenticate the GKE control plane
+type MasterAuth struct {
+	// ClusterCaCertificate is the base64 encoded certificate of the cluster CA
+	ClusterCaCertificate string
+}
+
+// PrivateClusterConfig represents the private networking of a GKE cluster
+type PrivateClusterConfig struct {
+	// PrivateEndpoint is the internal IP of the control plane
+	PrivateEndpoint string
+}
+
+// ControlPlaneEndpointsConfig represents the endpoints of the GKE control plane
+type ControlPlaneEndpointsConfig struct {
+	DNSEndpointConfig DNSEndpointConfig
+}
+
+// DNSEndpointConfig represents the DNS based endpoint of the GKE control plane
+type DNSEndpointConfig struct {
+	// Endpoint is the DNS name of the control plane
+	Endpoint string
 }
 
 func (cluster Cluster) IsRegional() bool {
@@ -74,7 +177,7 @@ func (cluster Cluster) IsRegional() bool {
 type Clusters []Cluster
 
 // ListClusters for the given projectId
-func ListClusters(cmdr commander.Commander, projectId string) (Clusters, error) {
+func ListClusters(ctx context.Context, cmdr commander.Commander, projectId string) (Clusters, error) {
 	args := []string{
 		"container",
 		"clusters",
@@ -83,10 +186,10 @@ func ListClusters(cmdr commander.Commander, projectId string) (Clusters, error)
 		projectId,
 		"--format=json",
 	}
-	response, err := cmdr.Execute("gcloud", args, nil)
+	response, err := cmdr.Execute(ctx, "gcloud", args, nil)
 	fullCommand := strings.Join(append([]string{"gcloud"}, args...), " ")
 	if err != nil {
-		return nil, fmt.Errorf("error executing %s: %v", fullCommand, err)
+		return nil, fmt.Errorf("error listing clusters of project %s: %w", projectId, err)
 	}
 	var clusters []Cluster
 	err = json.Unmarshal([]byte(response), &clusters)
@@ -1,6 +1,7 @@
 package gcloud
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -14,11 +15,11 @@ func TestListProjects(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 		commander := mock.NewCommander(ctrl)
-		commander.EXPECT().Execute("gcloud", []string{"projects", "list", "--format=json"}, nil).Return("", fmt.Errorf("please login"))
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"projects", "list", "--format=json"}, nil).Return("", fmt.Errorf("please login"))
 
-		projects, err := ListProjects(commander)
+		projects, err := ListProjects(context.Background(), commander, "")
 
-		assert.EqualError(t, err, "error executing gcloud projects list --format=json: please login")
+		assert.EqualError(t, err, "error listing projects: please login")
 		assert.Empty(t, projects)
 	})
 
@@ -26,9 +27,9 @@ func TestListProjects(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 		commander := mock.NewCommander(ctrl)
-		commander.EXPECT().Execute("gcloud", []string{"projects", "list", "--format=json"}, nil).Return("invalid json response", nil)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"projects", "list", "--format=json"}, nil).Return("invalid json response", nil)
 
-		projects, err := ListProjects(commander)
+		projects, err := ListProjects(context.Background(), commander, "")
 
 		assert.EqualError(t, err, "error unmarshaling the response from command gcloud projects list --format=json: invalid character 'i' looking for beginning of value")
 		assert.Empty(t, projects)
@@ -38,7 +39,7 @@ func TestListProjects(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 		commander := mock.NewCommander(ctrl)
-		commander.EXPECT().Execute("gcloud", []string{"projects", "list", "--format=json"}, nil).Return(`[
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"projects", "list", "--format=json"}, nil).Return(`[
   {
     "createTime": "2016-08-20T04:30:54.605Z",
     "lifecycleState": "ACTIVE",
@@ -51,10 +52,82 @@ func TestListProjects(t *testing.T) {
   }
 ]`, nil)
 
-		projects, err := ListProjects(commander)
+		projects, err := ListProjects(context.Background(), commander, "")
 
 		assert.NoError(t, err)
-		assert.Equal(t, Projects{Project{ProjectId: "clean-pottery"}}, projects)
+		assert.Equal(t, Projects{Project{ProjectId: "clean-pottery", Name: "My Project"}}, projects)
+	})
+
+	t.Run("should list the projects matching the filter", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"projects", "list", "--format=json", "--filter=labels.env=prod"}, nil).Return(`[{"projectId": "prod-project", "labels": {"env": "prod"}}]`, nil)
+
+		projects, err := ListProjects(context.Background(), commander, "labels.env=prod")
+
+		assert.NoError(t, err)
+		assert.Equal(t, Projects{Project{ProjectId: "prod-project", Labels: map[string]string{"env": "prod"}}}, projects)
+	})
+}
+
+func TestProject_Description(t *testing.T) {
+	t.Run("should describe the project by its ID when it has no name or labels", func(t *testing.T) {
+		assert.Equal(t, "clean-pottery", Project{ProjectId: "clean-pottery", Name: "clean-pottery"}.Description())
+	})
+
+	t.Run("should describe the project with its name and sorted labels", func(t *testing.T) {
+		project := Project{ProjectId: "clean-pottery", Name: "My Project", Labels: map[string]string{"team": "payments", "env": "prod"}}
+
+		assert.Equal(t, "clean-pottery (My Project) env=prod,team=payments", project.Description())
+	})
+
+	t.Run("should describe the project with the identity it was listed with", func(t *testing.T) {
+		project := Project{ProjectId: "clean-pottery", Name: "clean-pottery", Identity: Identity{Account: "test@example.com", Configuration: "work"}}
+
+		assert.Equal(t, "clean-pottery as test@example.com with configuration work", project.Description())
+	})
+}
+
+func TestListFolders(t *testing.T) {
+	t.Run("should return the folders of the organization", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"resource-manager", "folders", "list", "--organization=123", "--format=json"}, nil).Return(`[
+  {
+    "createTime": "2020-01-01T00:00:00.000Z",
+    "displayName": "payments",
+    "lifecycleState": "ACTIVE",
+    "name": "folders/456",
+    "parent": "organizations/123"
+  }
+]`, nil)
+
+		folders, err := ListFolders(context.Background(), commander, "organizations/123")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Folder{{Name: "folders/456", DisplayName: "payments", Parent: "organizations/123"}}, folders)
+		assert.Equal(t, "456", folders[0].ID())
+	})
+
+	t.Run("should return error if there is an error executing gcloud command", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"resource-manager", "folders", "list", "--folder=456", "--format=json"}, nil).Return("", fmt.Errorf("permission denied"))
+
+		folders, err := ListFolders(context.Background(), commander, "folders/456")
+
+		assert.EqualError(t, err, "error listing folders of folders/456: permission denied")
+		assert.Empty(t, folders)
+	})
+
+	t.Run("should return error for invalid parents", func(t *testing.T) {
+		folders, err := ListFolders(context.Background(), nil, "projects/test-project")
+
+		assert.EqualError(t, err, "invalid folder parent projects/test-project: should be organizations/<id> or folders/<id>")
+		assert.Empty(t, folders)
 	})
 }
 
@@ -65,7 +138,7 @@ func TestListClusters(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 		commander := mock.NewCommander(ctrl)
-		commander.EXPECT().Execute("gcloud", []string{"container",
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container",
 			"clusters",
 			"list",
 			"--project",
@@ -73,9 +146,9 @@ func TestListClusters(t *testing.T) {
 			"--format=json",
 		}, nil).Return("", fmt.Errorf("please login"))
 
-		projects, err := ListClusters(commander, projectId)
+		projects, err := ListClusters(context.Background(), commander, projectId)
 
-		assert.EqualError(t, err, "error executing gcloud container clusters list --project projectId --format=json: please login")
+		assert.EqualError(t, err, "error listing clusters of project projectId: please login")
 		assert.Empty(t, projects)
 	})
 
@@ -83,7 +156,7 @@ func TestListClusters(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 		commander := mock.NewCommander(ctrl)
-		commander.EXPECT().Execute("gcloud", []string{"container",
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container",
 			"clusters",
 			"list",
 			"--project",
@@ -91,7 +164,7 @@ func TestListClusters(t *testing.T) {
 			"--format=json",
 		}, nil).Return("invalid json response", nil)
 
-		projects, err := ListClusters(commander, projectId)
+		projects, err := ListClusters(context.Background(), commander, projectId)
 
 		assert.EqualError(t, err, "error unmarshaling the response from command gcloud container clusters list --project projectId --format=json: invalid character 'i' looking for beginning of value")
 		assert.Empty(t, projects)
@@ -101,7 +174,7 @@ func TestListClusters(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 		commander := mock.NewCommander(ctrl)
-		commander.EXPECT().Execute("gcloud", []string{"container",
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container",
 			"clusters",
 			"list",
 			"--project",
@@ -116,12 +189,16 @@ func TestListClusters(t *testing.T) {
     "defaultMaxPodsConstraint": {
       "maxPodsPerNode": "110"
     },
+    "endpoint": "10.0.0.1",
     "location": "asia-southeast1",
     "locations": [
       "asia-southeast1-a",
       "asia-southeast1-c",
       "asia-southeast1-b"
     ],
+    "masterAuth": {
+      "clusterCaCertificate": "Y2EtZGF0YQ=="
+    },
     "name": "cluster-one",
     "network": "default",
     "nodeIpv4CidrSize": 24,
@@ -153,10 +230,10 @@ func TestListClusters(t *testing.T) {
 ]`, nil)
 
 		expectedClusters := Clusters{
-			Cluster{Name: "cluster-one", Location: "asia-southeast1", Locations: []string{"asia-southeast1-a", "asia-southeast1-c", "asia-southeast1-b"}},
-			Cluster{Name: "cluster-two", Location: "asia-southeast1", Locations: []string{"asia-southeast1-a", "asia-southeast1-c", "asia-southeast1-b"}}}
+			Cluster{Name: "cluster-one", Location: "asia-southeast1", Locations: []string{"asia-southeast1-a", "asia-southeast1-c", "asia-southeast1-b"}, Endpoint: "10.0.0.1", MasterAuth: MasterAuth{ClusterCaCertificate: "Y2EtZGF0YQ=="}, Status: "RUNNING"},
+			Cluster{Name: "cluster-two", Location: "asia-southeast1", Locations: []string{"asia-southeast1-a", "asia-southeast1-c", "asia-southeast1-b"}, Status: "RUNNING"}}
 
-		projects, err := ListClusters(commander, projectId)
+		projects, err := ListClusters(context.Background(), commander, projectId)
 
 		assert.NoError(t, err)
 		assert.Equal(t, expectedClusters, projects)
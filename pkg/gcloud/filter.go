@@ -0,0 +1,60 @@
+package gcloud
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ClusterStatuses are the statuses GKE clusters can have
+var ClusterStatuses = []string{"PROVISIONING", "RUNNING", "RECONCILING", "STOPPING", "ERROR", "DEGRADED"}
+
+// ClusterFilter selects GKE clusters by their name, labels and status.
+// Its zero value selects every cluster.
+type ClusterFilter struct {
+	Name     *regexp.Regexp
+	Labels   map[string]string
+	Statuses []string
+}
+
+// NewClusterFilter creates a ClusterFilter selecting the clusters whose
+// name matches the regular expression name, which have all the given
+// key=value labels and whose status is one of statuses. Empty arguments
+// do not restrict the selection.
+func NewClusterFilter(name string, labels []string, statuses []string) (ClusterFilter, error) {
+	filter := ClusterFilter{}
+	if name != "" {
+		re, err := regexp.Compile(name)
+		if err != nil {
+			return ClusterFilter{}, fmt.Errorf("invalid cluster filter: %v", err)
+		}
+		filter.Name = re
+	}
+	for _, label := range labels {
+		keyValue := strings.SplitN(label, "=", 2)
+		if len(keyValue) != 2 || keyValue[0] == "" {
+			return ClusterFilter{}, fmt.Errorf("invalid cluster label %q: should be key=value", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = map[string]string{}
+		}
+		filter.Labels[keyValue[0]] = keyValue[1]
+	}
+	for _, status := range statuses {
+		filter.Statuses = append(filter.Statuses, strings.ToUpper(status))
+	}
+	return filter, nil
+}
+
+// Matches tells if the filter selects the cluster
+func (f ClusterFilter) Matches(cluster Cluster) bool {
+	if f.Name != nil && !f.Name.MatchString(cluster.Name) {
+		return false
+	}
+	for key, value := range f.Labels {
+		if actual, ok := cluster.ResourceLabels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return len(f.Statuses) == 0 || Contains(f.Statuses, cluster.Status)
+}
@@ -0,0 +1,88 @@
+package gcloud
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+)
+
+// recordedClusters returns the clusters of the recorded output of gcloud container clusters list
+func recordedClusters(t *testing.T) Clusters {
+	data, err := ioutil.ReadFile("testdata/clusters.json")
+	assert.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	commander := mock.NewCommander(ctrl)
+	commander.EXPECT().Execute(gomock.Any(), "gcloud", gomock.Any(), nil).Return(string(data), nil)
+
+	clusters, err := ListClusters(context.Background(), commander, "test-project")
+	assert.Nil(t, err)
+	return clusters
+}
+
+func names(clusters Clusters, filter ClusterFilter) []string {
+	var result []string
+	for _, cluster := range clusters {
+		if filter.Matches(cluster) {
+			result = append(result, cluster.Name)
+		}
+	}
+	return result
+}
+
+func TestClusterFilter(t *testing.T) {
+	clusters := recordedClusters(t)
+
+	t.Run("should parse the status and labels of the clusters", func(t *testing.T) {
+		assert.Equal(t, "RUNNING", clusters[0].Status)
+		assert.Equal(t, map[string]string{"env": "prod", "team": "payments"}, clusters[0].ResourceLabels)
+		assert.Equal(t, "PROVISIONING", clusters[2].Status)
+	})
+
+	t.Run("should select every cluster without filters", func(t *testing.T) {
+		filter, err := NewClusterFilter("", nil, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"prod-api", "staging-api", "prod-batch"}, names(clusters, filter))
+	})
+
+	t.Run("should select clusters whose name matches the regular expression", func(t *testing.T) {
+		filter, err := NewClusterFilter("^prod-", nil, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"prod-api", "prod-batch"}, names(clusters, filter))
+	})
+
+	t.Run("should select clusters having all the labels", func(t *testing.T) {
+		filter, err := NewClusterFilter("", []string{"team=payments", "env=prod"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"prod-api"}, names(clusters, filter))
+	})
+
+	t.Run("should select clusters having one of the statuses regardless of case", func(t *testing.T) {
+		filter, err := NewClusterFilter("", nil, []string{"provisioning", "ERROR"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"prod-batch"}, names(clusters, filter))
+	})
+
+	t.Run("should combine the filters", func(t *testing.T) {
+		filter, err := NewClusterFilter("api$", []string{"team=payments"}, []string{"RUNNING"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"prod-api", "staging-api"}, names(clusters, filter))
+	})
+
+	t.Run("should return error for invalid regular expressions and labels", func(t *testing.T) {
+		_, err := NewClusterFilter("prod-(", nil, nil)
+		assert.EqualError(t, err, "invalid cluster filter: error parsing regexp: missing closing ): `prod-(`")
+
+		_, err = NewClusterFilter("", []string{"env"}, nil)
+		assert.EqualError(t, err, `invalid cluster label "env": should be key=value`)
+	})
+}
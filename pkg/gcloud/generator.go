@@ -1,102 +1,265 @@
 package gcloud
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 	"gopkg.in/AlecAivazis/survey.v1"
 	"gopkg.in/yaml.v2"
 )
 
+// DefaultConcurrency is the number of projects whose
+// clusters are listed at once unless configured otherwise
+const DefaultConcurrency = 8
+
+// Options configures the gcloud generator
+type Options struct {
+	ProjectIDs     []string
+	AllProjects    bool
+	Accounts       []string
+	Configurations []string
+	Organization   string
+	Folder         string
+	ProjectFilter  string
+	AdditionalEnvs []string
+	ClusterFilter  string
+	ClusterLabels  []string
+	Statuses       []string
+	ClusterIDs     []string
+	MergeInto      string
+	Concurrency    int
+	Cache          *Cache
+	Refresh        bool
+	Apply          bool
+	Force          bool
+	Wait           bool
+	DryRun         bool
+	Output         kubetmuxp.Output
+}
+
 type Generator struct {
-	projectIDs     []string
-	allProjects    bool
-	additionalEnvs []string
-	apply          bool
+	options  Options
+	fs       filesystem.FileSystem
+	cmdr     commander.Commander
+	clusters *ClusterLookup
+	fresh    *ClusterLookup
+	filter   ClusterFilter
+	scope    ProjectScope
+	log      *logging.Logger
 }
 
-func NewGenerator(projectIDs []string, allProjects bool, additionalEnvs []string, apply bool) Generator {
-	return Generator{
-		projectIDs:     projectIDs,
-		allProjects:    allProjects,
-		additionalEnvs: additionalEnvs,
-		apply:          apply,
-	}
+func NewGenerator(options Options, fs filesystem.FileSystem, cmdr commander.Commander, log *logging.Logger) Generator {
+	return Generator{options: options, fs: fs, cmdr: cmdr, log: log}
 }
 
-func (g Generator) Generate(outStream, errStream io.Writer) {
-	cmdr := &commander.Default{}
-	projects, err := g.getProjects(cmdr)
+// Generate writes the kube-tmuxp config of the clusters in the selected
+// projects to out, or generates their kubeconfigs and tmuxp configs when
+// applying. Progress is logged so that out holds nothing but the config.
+func (g Generator) Generate(ctx context.Context, out io.Writer) {
+	filter, err := NewClusterFilter(g.options.ClusterFilter, g.options.ClusterLabels, g.options.Statuses)
+	if err != nil {
+		g.log.Error(err.Error())
+		os.Exit(1)
+	}
+	g.filter = filter
+	scope, err := NewProjectScope(g.options.Organization, g.options.Folder, g.options.ProjectFilter)
+	if err != nil {
+		g.log.Error(err.Error())
+		os.Exit(1)
+	}
+	g.scope = scope
+	if err := validateClusterIDs(g.options.ClusterIDs); err != nil {
+		g.log.Error(err.Error())
+		os.Exit(1)
+	}
+	if g.options.Concurrency < 0 {
+		g.log.Error(fmt.Sprintf("invalid concurrency %d: should be positive", g.options.Concurrency))
+		os.Exit(1)
+	}
+	if g.options.Concurrency == 0 {
+		g.options.Concurrency = DefaultConcurrency
+	}
+
+	// gcloud is retried with the default policy as there is no config file
+	retrying, err := commander.NewRetrying(g.cmdr, commander.RetryPolicy{}, g.log)
+	if err != nil {
+		g.log.Error(err.Error())
+		os.Exit(1)
+	}
+	g.cmdr = retrying
+	discovery := g.cmdr
+	if g.options.Cache != nil {
+		discovery = g.options.Cache.Commander(g.cmdr, g.options.Refresh, g.log)
+	}
+	g.clusters = NewClusterLookup(discovery)
+	// the kubeconfigs are written from the listed clusters, so the clusters
+	// of the selected projects are listed again if they may be cached
+	g.fresh = g.clusters
+	if discovery != g.cmdr {
+		g.fresh = NewClusterLookup(g.cmdr)
+	}
+
+	projects, err := g.getProjects(ctx, discovery)
 	if err != nil {
-		_, _ = fmt.Fprintf(errStream, err.Error())
+		g.log.Error(err.Error())
 		os.Exit(1)
 	}
-	if !g.apply {
-		g.printConfigFiles(projects, outStream)
-		_, _ = fmt.Fprintf(errStream, "Run with --apply to directly generate tmuxp configs for various Kubernetes contexts\n")
+	if g.options.MergeInto != "" {
+		if err := g.mergeConfigFile(projects); err != nil {
+			g.log.Error(err.Error())
+			os.Exit(1)
+		}
+	} else if !g.options.Apply {
+		g.printConfigFiles(projects, out)
+	}
+	if !g.options.Apply {
+		g.log.Info("Run with --apply to directly generate tmuxp configs for various Kubernetes contexts")
 		return
 	}
-	err = g.generateKubeTmuxpFiles(cmdr, projects)
+	err = g.generateKubeTmuxpFiles(ctx, projects)
 	if err != nil {
-		_, _ = fmt.Fprintf(errStream, err.Error())
+		g.log.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
-func (g Generator) generateKubeTmuxpFiles(cmdr commander.Commander, projects kubetmuxp.Projects) error {
-	fs := &filesystem.Default{}
-	kubeCfg, err := kubeconfig.New(fs, cmdr)
+func (g Generator) generateKubeTmuxpFiles(ctx context.Context, projects kubetmuxp.Projects) error {
+	kubeCfg, err := kubeconfig.New(g.fs, g.cmdr)
+	if err != nil {
+		return err
+	}
 
-	config, err := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg)
+	config, err := kubetmuxp.NewConfigWithProjects(projects, g.fs, kubeCfg, g.log)
 	if err != nil {
 		return err
 	}
-	return config.Process()
+	if err := config.SetOutput(g.options.Output); err != nil {
+		return err
+	}
+	config.SetClusterLookup(g.fresh)
+
+	kubeCfg = config.KubeConfig()
+	return kubeCfg.Locked(ctx, g.options.Wait, g.options.DryRun, func() error {
+		return config.Process(ctx, g.options.Force)
+	})
 }
 
-func (g Generator) printConfigFiles(projects kubetmuxp.Projects, outStream io.Writer) {
+func (g Generator) printConfigFiles(projects kubetmuxp.Projects, out io.Writer) {
 	bytes, err := yaml.Marshal(map[string]kubetmuxp.Projects{"projects": projects})
 	if err != nil {
-		_, _ = fmt.Fprintln(outStream, err)
+		g.log.Error(err.Error())
 		os.Exit(1)
 	}
-	fmt.Println(string(bytes))
+	_, _ = fmt.Fprintln(out, string(bytes))
+}
+
+// mergeConfigFile merges the discovered projects into the MergeInto config
+// file, creating it if needed, and flags the clusters of these projects
+// that were not listed anymore
+func (g Generator) mergeConfigFile(projects kubetmuxp.Projects) error {
+	file := g.options.MergeInto
+	var data []byte
+	reader, err := g.fs.Open(file)
+	if err == nil {
+		data, err = ioutil.ReadAll(reader)
+		if closer, ok := reader.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading config %s: %v", file, err)
+	}
+
+	listed := func(project string, cluster kubetmuxp.Cluster) bool {
+		location := cluster.Zone
+		if location == "" {
+			location = cluster.Region
+		}
+		return g.clusters.Listed(project, cluster.Name, location)
+	}
+	merged, result, err := kubetmuxp.Merge(data, projects, listed)
+	if err != nil {
+		return fmt.Errorf("error merging into config %s: %v", file, err)
+	}
+	for _, cluster := range result.Missing {
+		g.log.Warn("Flagged cluster that was not found anymore", "cluster", cluster)
+	}
+
+	if err := filesystem.ReplaceFile(g.fs, file, merged); err != nil {
+		return err
+	}
+	g.log.Info("Merged clusters into config", "file", file, "added", len(result.Added), "missing", len(result.Missing))
+	return nil
 }
 
-func (g Generator) getProjects(cmdr commander.Commander) (kubetmuxp.Projects, error) {
+func (g Generator) getProjects(ctx context.Context, cmdr commander.Commander) (kubetmuxp.Projects, error) {
 	gCloudProjects := Projects{}
-	if g.projectIDs != nil && len(g.projectIDs) > 0 {
-		for _, projectID := range g.projectIDs {
-			gCloudProjects = append(gCloudProjects, Project{ProjectId: projectID})
+	// clusters are picked interactively only when projects are
+	interactive := false
+	if g.options.ProjectIDs != nil && len(g.options.ProjectIDs) > 0 {
+		for _, projectID := range g.options.ProjectIDs {
+			gCloudProjects = append(gCloudProjects, Project{ProjectId: projectID, Identity: g.identities()[0]})
+		}
+	} else if len(g.options.ClusterIDs) > 0 && !g.options.AllProjects {
+		for _, projectID := range clusterProjectIDs(g.options.ClusterIDs) {
+			gCloudProjects = append(gCloudProjects, Project{ProjectId: projectID, Identity: g.identities()[0]})
 		}
 	} else {
-		gCloudProjects = getGCloudProjects(cmdr, g.allProjects)
+		gCloudProjects = getGCloudProjects(ctx, cmdr, g.scope, g.identities(), g.options.AllProjects, g.log)
+		interactive = !g.options.AllProjects
 	}
 	additionalEnvsMap := map[string]string{}
-	for _, env := range g.additionalEnvs {
+	for _, env := range g.options.AdditionalEnvs {
 		envKeyValue := strings.Split(env, "=")
 		if len(envKeyValue) != 2 {
 			return nil, fmt.Errorf("wrong env format: should be key=value")
 		}
 		additionalEnvsMap[envKeyValue[0]] = envKeyValue[1]
 	}
-	projects := make(kubetmuxp.Projects, 0, len(gCloudProjects))
-	for _, gCloudProject := range gCloudProjects {
-		clusters, err := ListClusters(cmdr, gCloudProject.ProjectId)
-		if err != nil {
-			return nil, err
-		}
-		_, _ = fmt.Fprintf(os.Stderr, "Number of clusters for %s project: %d\n", gCloudProject, len(clusters))
+	gCloudProjects, projectClusters, err := g.listClusters(ctx, cmdr, gCloudProjects)
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]Clusters, 0, len(gCloudProjects))
+	var candidates []string
+	for i, gCloudProject := range gCloudProjects {
+		clusters := projectClusters[i]
+		g.clusters.Add(gCloudProject.ProjectId, gCloudProject.Identity, clusters)
 
-		kubetmuxpClusters := make(kubetmuxp.Clusters, 0, len(clusters))
+		matching := make(Clusters, 0, len(clusters))
 		for _, cluster := range clusters {
+			if !g.filter.Matches(cluster) {
+				g.log.Debug("Skipping cluster not matching the filters", "project", gCloudProject.ProjectId, "cluster", cluster.Name, "status", cluster.Status)
+				continue
+			}
+			matching = append(matching, cluster)
+			candidates = append(candidates, ClusterID(gCloudProject.ProjectId, cluster))
+		}
+		listed = append(listed, matching)
+	}
+	selected, err := g.selectClusters(candidates, interactive)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make(kubetmuxp.Projects, 0, len(gCloudProjects))
+	for i, gCloudProject := range gCloudProjects {
+		kubetmuxpClusters := make(kubetmuxp.Clusters, 0, len(listed[i]))
+		for _, cluster := range listed[i] {
+			if !selected[ClusterID(gCloudProject.ProjectId, cluster)] {
+				continue
+			}
 			zone := ""
 			region := ""
 			isRegional := cluster.IsRegional()
@@ -119,14 +282,144 @@ func (g Generator) getProjects(cmdr commander.Commander) (kubetmuxp.Projects, er
 				Envs:    mergeEnvs(baseEnvs, additionalEnvsMap),
 			})
 		}
+		if len(kubetmuxpClusters) == 0 {
+			g.log.Debug("Skipping project without selected clusters", "project", gCloudProject.ProjectId)
+			continue
+		}
 		projects = append(projects, kubetmuxp.Project{
-			Name:     gCloudProject.ProjectId,
-			Clusters: kubetmuxpClusters,
+			Name:                gCloudProject.ProjectId,
+			Account:             gCloudProject.Identity.Account,
+			GCloudConfiguration: gCloudProject.Identity.Configuration,
+			Clusters:            kubetmuxpClusters,
 		})
 	}
 	return projects, nil
 }
 
+// listClusters lists the clusters of the projects concurrently, at most
+// Concurrency projects at once. The projects whose clusters cannot be
+// listed, like the ones without the container API enabled, are skipped
+// with a warning; it fails only when all of them are.
+func (g Generator) listClusters(ctx context.Context, cmdr commander.Commander, projects Projects) (Projects, []Clusters, error) {
+	clusters := make([]Clusters, len(projects))
+	errs := make([]error, len(projects))
+	slots := make(chan struct{}, g.options.Concurrency)
+	var wg sync.WaitGroup
+	for i := range projects {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			clusters[i], errs[i] = ListClusters(ctx, projects[i].Identity.Commander(cmdr), projects[i].ProjectId)
+		}(i)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	listedProjects := make(Projects, 0, len(projects))
+	listedClusters := make([]Clusters, 0, len(projects))
+	var skipped []string
+	for i, project := range projects {
+		if errs[i] != nil {
+			g.log.Warn("Skipping project whose clusters cannot be listed", "project", project.ProjectId, "error", errs[i])
+			skipped = append(skipped, project.ProjectId)
+			continue
+		}
+		g.log.Info("Listed clusters", "project", project.ProjectId, "clusters", len(clusters[i]))
+		listedProjects = append(listedProjects, project)
+		listedClusters = append(listedClusters, clusters[i])
+	}
+	if len(skipped) > 0 {
+		if len(listedProjects) == 0 {
+			return nil, nil, fmt.Errorf("cannot list the clusters of any of the projects: %v", errs[0])
+		}
+		g.log.Warn("Skipped projects", "projects", strings.Join(skipped, ","))
+	}
+	return listedProjects, listedClusters, nil
+}
+
+// identities returns the identities of the Accounts and Configurations
+// options, which projects are listed with, or else the active identity.
+// Projects given by their ID use the first one.
+func (g Generator) identities() []Identity {
+	var identities []Identity
+	for _, account := range g.options.Accounts {
+		identities = append(identities, Identity{Account: account})
+	}
+	for _, configuration := range g.options.Configurations {
+		identities = append(identities, Identity{Configuration: configuration})
+	}
+	if len(identities) == 0 {
+		return []Identity{{}}
+	}
+	return identities
+}
+
+// selectClusters returns the IDs of the candidates that are in the
+// ClusterIDs option, or else picked interactively if asked to, or else
+// the IDs of all the candidates
+func (g Generator) selectClusters(candidates []string, interactive bool) (map[string]bool, error) {
+	selected := map[string]bool{}
+	switch {
+	case len(g.options.ClusterIDs) > 0:
+		available := map[string]bool{}
+		for _, id := range candidates {
+			available[id] = true
+		}
+		for _, id := range g.options.ClusterIDs {
+			if !available[id] {
+				g.log.Warn("Skipping cluster that was not found or does not match the filters", "cluster", id)
+				continue
+			}
+			selected[id] = true
+		}
+	case interactive && len(candidates) > 0:
+		ids, err := multiSelect("Select the clusters that you want to configure:", candidates)
+		if err != nil {
+			return nil, fmt.Errorf("error selecting clusters: %v", err)
+		}
+		g.log.Info("Selected clusters", "clusters", len(ids))
+		for _, id := range ids {
+			selected[id] = true
+		}
+	default:
+		for _, id := range candidates {
+			selected[id] = true
+		}
+	}
+	return selected, nil
+}
+
+// ClusterID identifies a cluster of the project as project/location/name
+func ClusterID(projectID string, cluster Cluster) string {
+	return fmt.Sprintf("%s/%s/%s", projectID, cluster.Location, cluster.Name)
+}
+
+func validateClusterIDs(ids []string) error {
+	for _, id := range ids {
+		parts := strings.Split(id, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("invalid cluster ID %q: should be project/location/name", id)
+		}
+	}
+	return nil
+}
+
+// clusterProjectIDs returns the projects of the given cluster IDs
+func clusterProjectIDs(ids []string) []string {
+	var projectIDs []string
+	for _, id := range ids {
+		projectID := strings.Split(id, "/")[0]
+		if !Contains(projectIDs, projectID) {
+			projectIDs = append(projectIDs, projectID)
+		}
+	}
+	return projectIDs
+}
+
 func mergeEnvs(base, additionalEnvsMap map[string]string) map[string]string {
 	for k, v := range additionalEnvsMap {
 		expandedValue := os.Expand(v, func(s string) string {
@@ -142,30 +435,72 @@ func mergeEnvs(base, additionalEnvsMap map[string]string) map[string]string {
 	return base
 }
 
-func getGCloudProjects(cmdr commander.Commander, allProjects bool) Projects {
-	projects, err := ListProjects(cmdr)
-	if err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+// getGCloudProjects lists the projects in the scope with each of the
+// identities, the first identity seeing a project being the one it uses
+func getGCloudProjects(ctx context.Context, cmdr commander.Commander, scope ProjectScope, identities []Identity, allProjects bool, log *logging.Logger) Projects {
+	var projects Projects
+	seen := map[string]bool{}
+	for _, identity := range identities {
+		identityCmdr := identity.Commander(cmdr)
+		filter, err := scope.Expression(ctx, identityCmdr)
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		listed, err := ListProjects(ctx, identityCmdr, filter)
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		log.With(identity.logFields()...).Info("Listed gcloud projects", "projects", len(listed))
+		for _, project := range listed {
+			if seen[project.ProjectId] {
+				continue
+			}
+			seen[project.ProjectId] = true
+			project.Identity = identity
+			projects = append(projects, project)
+		}
 	}
-	_, _ = fmt.Fprintf(os.Stderr, "Number of gcloud projects: %d\n", len(projects))
 	if allProjects {
 		return projects
 	}
 	selectedProjects, err := getSelectedProjects(projects)
 	if err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, err)
+		log.Error(err.Error())
 		os.Exit(1)
 	}
-	_, _ = fmt.Fprintf(os.Stderr, "Number of selected gcloud projects: %d\n", len(selectedProjects))
+	log.Info("Selected gcloud projects", "projects", len(selectedProjects))
 	return selectedProjects
 }
 
+// getSelectedProjects prompts to pick some of the projects, described
+// along with their name and labels so that they can be searched by them
 func getSelectedProjects(projects Projects) (Projects, error) {
-	var selectedProjectIDs []string
+	ids := map[string]string{}
+	descriptions := make([]string, 0, len(projects))
+	for _, project := range projects {
+		description := project.Description()
+		ids[description] = project.ProjectId
+		descriptions = append(descriptions, description)
+	}
+	selected, err := multiSelect("Select gcloud projects that you want to configure:", descriptions)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting project: %v", err)
+	}
+	selectedProjectIDs := make([]string, 0, len(selected))
+	for _, description := range selected {
+		selectedProjectIDs = append(selectedProjectIDs, ids[description])
+	}
+	return projects.Filter(selectedProjectIDs), nil
+}
+
+// multiSelect prompts on stderr to pick some of the options, which can be fuzzy filtered
+func multiSelect(message string, options []string) ([]string, error) {
+	var selected []string
 	prompt := &survey.MultiSelect{
-		Message: "Select gcloud projects that you want to configure:",
-		Options: projects.IDs(),
+		Message: message,
+		Options: options,
 		FilterFn: func(s string, options []string) []string {
 			var acc []string
 			for _, option := range options {
@@ -181,9 +516,8 @@ func getSelectedProjects(projects Projects) (Projects, error) {
 		return nil
 	}
 	validator := func(ans interface{}) error { return nil }
-	err := survey.AskOne(prompt, &selectedProjectIDs, validator, opt)
-	if err != nil {
-		return nil, fmt.Errorf("error selecting project: %v", err)
+	if err := survey.AskOne(prompt, &selected, validator, opt); err != nil {
+		return nil, err
 	}
-	return projects.Filter(selectedProjectIDs), nil
+	return selected, nil
 }
@@ -1,10 +1,24 @@
 package gcloud
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/golden"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+	"gopkg.in/yaml.v2"
 )
 
 func Test_mergeEnvs(t *testing.T) {
@@ -57,3 +71,334 @@ func Test_mergeEnvs(t *testing.T) {
 		}, result)
 	})
 }
+
+func TestGenerate(t *testing.T) {
+	t.Run("should generate kubeconfigs and tmuxp configs for the clusters of all projects", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		cli := fakecli.New(fixture)
+		options := Options{AllProjects: true, Apply: true, AdditionalEnvs: []string{"CLUSTER=${GCP_PROJECT_ID}/${KUBETMUXP_CLUSTER_NAME}"}}
+
+		NewGenerator(options, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+
+		golden.Assert(t, "testdata/generate.golden", golden.Tree(fs, "/home/test", "/home/test/.kube", "/home/test/.tmuxp"))
+		calls := cli.Calls()
+		assert.Equal(t, "gcloud projects list --format=json", calls[0])
+		assert.ElementsMatch(t, []string{
+			"gcloud container clusters list --project test-project --format=json",
+			"gcloud container clusters list --project another-project --format=json",
+		}, calls[1:])
+	})
+
+	t.Run("should write only the config to out and log the progress", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		cli := fakecli.New(fixture)
+		var out, log bytes.Buffer
+
+		NewGenerator(Options{ProjectIDs: []string{"another-project"}}, fs, cli, logging.New(&log, logging.InfoLevel, logging.JSONFormat)).Generate(context.Background(), &out)
+
+		var config map[string]interface{}
+		assert.Nil(t, yaml.Unmarshal(out.Bytes(), &config))
+		assert.Len(t, config["projects"], 1)
+		lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+		assert.Len(t, lines, 2)
+		for _, line := range lines {
+			var entry map[string]interface{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+			assert.Equal(t, "info", entry["level"])
+		}
+		assert.Contains(t, lines[0], `"msg":"Listed clusters","project":"another-project","clusters":1}`)
+	})
+
+	t.Run("should generate only the clusters matching the filters", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		cli := fakecli.New(fakecli.Fixture{Projects: []fakecli.Project{{
+			ProjectID: "test-project",
+			Clusters: []fakecli.Cluster{
+				{Name: "prod-api", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Endpoint: "10.0.0.1", ResourceLabels: map[string]string{"env": "prod"}},
+				{Name: "prod-batch", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Status: "PROVISIONING", ResourceLabels: map[string]string{"env": "prod"}},
+				{Name: "staging-api", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Endpoint: "10.0.0.2", ResourceLabels: map[string]string{"env": "staging"}},
+				{Name: "unlabeled-api", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Endpoint: "10.0.0.3"},
+			},
+		}}})
+		options := Options{ProjectIDs: []string{"test-project"}, ClusterFilter: "-api$", ClusterLabels: []string{"env=prod"}, Statuses: []string{"RUNNING"}, Apply: true}
+
+		NewGenerator(options, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+
+		infos, err := fs.ReadDir("/home/test/.tmuxp")
+		assert.Nil(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, "prod-api.yaml", infos[0].Name())
+	})
+
+	t.Run("should generate the clusters of the projects in the folder matching the project filter", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		cli := fakecli.New(fakecli.Fixture{
+			Folders: []fakecli.Folder{{ID: "10", Parent: "organizations/1"}, {ID: "20", Parent: "folders/10"}},
+			Projects: []fakecli.Project{
+				{ProjectID: "prod-project", Labels: map[string]string{"env": "prod"}, Parent: "folders/20", Clusters: []fakecli.Cluster{{Name: "prod-cluster", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Endpoint: "10.0.0.1"}}},
+				{ProjectID: "dev-project", Labels: map[string]string{"env": "dev"}, Parent: "folders/20"},
+				{ProjectID: "other-project", Labels: map[string]string{"env": "prod"}, Parent: "organizations/2"},
+			},
+		})
+		options := Options{AllProjects: true, Folder: "folders/10", ProjectFilter: "labels.env=prod", Apply: true}
+
+		NewGenerator(options, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+
+		infos, err := fs.ReadDir("/home/test/.tmuxp")
+		assert.Nil(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, "prod-cluster.yaml", infos[0].Name())
+		assert.Equal(t, []string{
+			"gcloud resource-manager folders list --folder=10 --format=json",
+			"gcloud resource-manager folders list --folder=20 --format=json",
+			"gcloud projects list --format=json --filter=parent.id=(10 20) AND (labels.env=prod)",
+			"gcloud container clusters list --project prod-project --format=json",
+		}, cli.Calls())
+	})
+
+	t.Run("should merge the discovered clusters into the config instead of printing it", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", []byte(`projects:
+- name: test-project
+  clusters:
+  # hand edited
+  - name: zonal-cluster
+    zone: europe-west1-b
+    context: zonal
+  - name: deleted-cluster
+    zone: europe-west1-b
+    context: deleted-cluster
+`), 0600))
+		cli := fakecli.New(fixture)
+		var out, log bytes.Buffer
+		options := Options{ProjectIDs: []string{"test-project"}, MergeInto: "/home/test/.kube-tmuxp.yaml"}
+
+		NewGenerator(options, fs, cli, logging.New(&log, logging.WarnLevel, logging.TextFormat)).Generate(context.Background(), &out)
+
+		assert.Empty(t, out.String())
+		assert.Equal(t, "warning: Flagged cluster that was not found anymore cluster=test-project/deleted-cluster\n", log.String())
+		merged, err := fs.ReadFile("/home/test/.kube-tmuxp.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, `projects:
+  - name: test-project
+    clusters:
+      # hand edited
+      - name: zonal-cluster
+        zone: europe-west1-b
+        context: zonal
+      # kube-tmuxp: not found by the last discovery
+      - name: deleted-cluster
+        zone: europe-west1-b
+        context: deleted-cluster
+      - name: regional-cluster
+        region: europe-west1
+        context: regional-cluster
+        envs:
+          GCP_PROJECT_ID: test-project
+          KUBETMUXP_CLUSTER_IS_REGIONAL: "true"
+          KUBETMUXP_CLUSTER_LOCATION: europe-west1
+          KUBETMUXP_CLUSTER_NAME: regional-cluster
+`, string(merged))
+	})
+
+	t.Run("should keep the permissions of the config merged into", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		assert.Nil(t, fs.AddFile("/home/test/.kube-tmuxp.yaml", []byte("projects: []\n"), 0644))
+		options := Options{ProjectIDs: []string{"test-project"}, MergeInto: "/home/test/.kube-tmuxp.yaml"}
+
+		NewGenerator(options, fs, fakecli.New(fixture), nil).Generate(context.Background(), ioutil.Discard)
+
+		info, err := fs.Stat("/home/test/.kube-tmuxp.yaml")
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	})
+
+	t.Run("should leave out the projects without selected clusters", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		options := Options{ProjectIDs: []string{"test-project", "another-project"}, ClusterFilter: "^regional-", MergeInto: "/home/test/.kube-tmuxp.yaml"}
+
+		NewGenerator(options, fs, fakecli.New(fixture), nil).Generate(context.Background(), ioutil.Discard)
+
+		merged, err := fs.ReadFile("/home/test/.kube-tmuxp.yaml")
+		assert.Nil(t, err)
+		var config map[string]kubetmuxp.Projects
+		assert.Nil(t, yaml.Unmarshal(merged, &config))
+		assert.Len(t, config["projects"], 1)
+		assert.Equal(t, "test-project", config["projects"][0].Name)
+	})
+
+	t.Run("should list the projects and clusters again only when refreshing the cache", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		cache := NewCache("/home/test/.cache/kube-tmuxp/gcloud", fs, time.Hour)
+		cli := fakecli.New(fixture)
+
+		NewGenerator(Options{AllProjects: true, Cache: cache}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+		NewGenerator(Options{AllProjects: true, Cache: cache}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+		assert.Len(t, cli.Calls(), 5)
+
+		NewGenerator(Options{AllProjects: true, Cache: cache, Refresh: true}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+		assert.Len(t, cli.Calls(), 9)
+		assert.Equal(t, "gcloud config get-value account", cli.Calls()[4])
+	})
+
+	t.Run("should take the projects from the cache but list the clusters again when applying", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		cache := NewCache("/home/test/.cache/kube-tmuxp/gcloud", fs, time.Hour)
+		cli := fakecli.New(fixture)
+		NewGenerator(Options{AllProjects: true, Cache: cache}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+		calls := len(cli.Calls())
+
+		NewGenerator(Options{AllProjects: true, Cache: cache, Apply: true}, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+
+		assert.Equal(t, "gcloud config get-value account", cli.Calls()[calls])
+		assert.ElementsMatch(t, []string{
+			"gcloud container clusters list --project test-project --format=json",
+			"gcloud container clusters list --project another-project --format=json",
+		}, cli.Calls()[calls+1:])
+		_, err = fs.ReadFile("/home/test/.kube/configs/regional-cluster")
+		assert.Nil(t, err)
+	})
+
+	t.Run("should generate the clusters of the projects of each account with its credentials", func(t *testing.T) {
+		fs := filesystem.NewMemory("/home/test")
+		cli := fakecli.New(fakecli.Fixture{
+			Account:        "me@example.com",
+			Configurations: map[string]string{"work": "work@example.com"},
+			Projects: []fakecli.Project{
+				{ProjectID: "shared-project", Clusters: []fakecli.Cluster{{Name: "shared-cluster", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Endpoint: "10.0.0.1"}}},
+				{ProjectID: "work-project", Accounts: []string{"work@example.com"}, Clusters: []fakecli.Cluster{{Name: "work-cluster", Location: "europe-west1-b", Locations: []string{"europe-west1-b"}, Endpoint: "10.0.0.2"}}},
+			},
+		})
+		var out bytes.Buffer
+		options := Options{AllProjects: true, Accounts: []string{"me@example.com"}, Configurations: []string{"work"}}
+
+		NewGenerator(options, fs, cli, nil).Generate(context.Background(), &out)
+
+		var config kubetmuxp.Config
+		assert.Nil(t, yaml.Unmarshal(out.Bytes(), &config))
+		assert.Len(t, config.Projects, 2)
+		assert.Equal(t, "me@example.com", config.Projects[0].Account)
+		assert.Equal(t, "work-project", config.Projects[1].Name)
+		assert.Equal(t, "work", config.Projects[1].GCloudConfiguration)
+		assert.Equal(t, []string{
+			"gcloud projects list --format=json --account=me@example.com",
+			"gcloud projects list --format=json",
+		}, cli.Calls()[:2])
+		assert.ElementsMatch(t, []string{
+			"gcloud container clusters list --project shared-project --format=json --account=me@example.com",
+			"gcloud container clusters list --project work-project --format=json",
+		}, cli.Calls()[2:])
+
+		options.Apply = true
+		NewGenerator(options, fs, cli, nil).Generate(context.Background(), ioutil.Discard)
+
+		kubeCfg, err := fs.ReadFile("/home/test/.kube/configs/work-cluster")
+		assert.Nil(t, err)
+		assert.Contains(t, string(kubeCfg), "- name: CLOUDSDK_ACTIVE_CONFIG_NAME\n        value: work\n")
+	})
+
+	t.Run("should generate only the given clusters and list only their projects", func(t *testing.T) {
+		fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+		assert.Nil(t, err)
+		fs := filesystem.NewMemory("/home/test")
+		cli := fakecli.New(fixture)
+		var out, log bytes.Buffer
+		options := Options{ClusterIDs: []string{"test-project/europe-west1/regional-cluster", "test-project/europe-west1-b/missing-cluster"}, Apply: true}
+
+		NewGenerator(options, fs, cli, logging.New(&log, logging.WarnLevel, logging.TextFormat)).Generate(context.Background(), &out)
+
+		infos, err := fs.ReadDir("/home/test/.tmuxp")
+		assert.Nil(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, "regional-cluster.yaml", infos[0].Name())
+		assert.Equal(t, []string{"gcloud container clusters list --project test-project --format=json"}, cli.Calls())
+		assert.Equal(t, "warning: Skipping cluster that was not found or does not match the filters cluster=test-project/europe-west1-b/missing-cluster\n", log.String())
+	})
+}
+
+func TestGenerator_listClusters(t *testing.T) {
+	fixture, err := fakecli.LoadFixture("testdata/gcloud.yaml")
+	assert.Nil(t, err)
+
+	t.Run("should skip the projects whose clusters cannot be listed with a warning", func(t *testing.T) {
+		var log bytes.Buffer
+		g := NewGenerator(Options{Concurrency: 2}, nil, nil, logging.New(&log, logging.WarnLevel, logging.TextFormat))
+		projects := Projects{{ProjectId: "test-project"}, {ProjectId: "disabled-project"}, {ProjectId: "another-project"}}
+
+		listed, clusters, err := g.listClusters(context.Background(), fakecli.New(fixture), projects)
+
+		assert.Nil(t, err)
+		assert.Equal(t, Projects{{ProjectId: "test-project"}, {ProjectId: "another-project"}}, listed)
+		assert.Len(t, clusters, 2)
+		assert.Len(t, clusters[0], 2)
+		assert.Len(t, clusters[1], 1)
+		assert.Equal(t, "warning: Skipping project whose clusters cannot be listed project=disabled-project error=\"error listing clusters of project disabled-project: ERROR: (gcloud.container.clusters) ResponseError: code=403, message=Project disabled-project not found or permission denied\"\n"+
+			"warning: Skipped projects projects=disabled-project\n", log.String())
+	})
+
+	t.Run("should return error when the clusters of none of the projects can be listed", func(t *testing.T) {
+		g := NewGenerator(Options{Concurrency: 2}, nil, nil, nil)
+
+		_, _, err := g.listClusters(context.Background(), fakecli.New(fixture), Projects{{ProjectId: "disabled-project"}})
+
+		assert.EqualError(t, err, "cannot list the clusters of any of the projects: error listing clusters of project disabled-project: ERROR: (gcloud.container.clusters) ResponseError: code=403, message=Project disabled-project not found or permission denied")
+	})
+
+	t.Run("should list the clusters of at most Concurrency projects at once", func(t *testing.T) {
+		cli := &concurrencyCounter{Commander: fakecli.New(fixture)}
+		g := NewGenerator(Options{Concurrency: 2}, nil, nil, nil)
+		projects := Projects{{ProjectId: "test-project"}, {ProjectId: "another-project"}, {ProjectId: "test-project"}, {ProjectId: "another-project"}, {ProjectId: "test-project"}}
+
+		listed, _, err := g.listClusters(context.Background(), cli, projects)
+
+		assert.Nil(t, err)
+		assert.Equal(t, projects, listed)
+		assert.Equal(t, int32(2), cli.max)
+	})
+}
+
+// concurrencyCounter records how many commands run at most at once
+type concurrencyCounter struct {
+	commander.Commander
+	running int32
+	max     int32
+}
+
+func (c *concurrencyCounter) Execute(ctx context.Context, cmd string, args []string, envs []string) (string, error) {
+	running := atomic.AddInt32(&c.running, 1)
+	defer atomic.AddInt32(&c.running, -1)
+	for {
+		max := atomic.LoadInt32(&c.max)
+		if running <= max || atomic.CompareAndSwapInt32(&c.max, max, running) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return c.Commander.Execute(ctx, cmd, args, envs)
+}
+
+func Test_validateClusterIDs(t *testing.T) {
+	t.Run("should accept project/location/name IDs", func(t *testing.T) {
+		assert.Nil(t, validateClusterIDs([]string{"test-project/europe-west1/regional-cluster"}))
+	})
+
+	t.Run("should return error for IDs missing a part", func(t *testing.T) {
+		err := validateClusterIDs([]string{"test-project/europe-west1/regional-cluster", "test-project//zonal-cluster"})
+
+		assert.EqualError(t, err, `invalid cluster ID "test-project//zonal-cluster": should be project/location/name`)
+	})
+}
@@ -0,0 +1,71 @@
+package gcloud
+
+import (
+	"context"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+// Identity is the gcloud account and configuration gcloud commands run
+// with, and the service account they impersonate. Its zero value uses
+// the active ones.
+type Identity struct {
+	Account                   string
+	Configuration             string
+	ImpersonateServiceAccount string
+}
+
+// IdentityOf returns the identity used for the project of a config
+func IdentityOf(project kubetmuxp.Project) Identity {
+	return Identity{
+		Account:                   project.Account,
+		Configuration:             project.GCloudConfiguration,
+		ImpersonateServiceAccount: project.ImpersonateServiceAccount,
+	}
+}
+
+// Commander returns a Commander running the gcloud commands of base with
+// --account, --impersonate-service-account and the
+// CLOUDSDK_ACTIVE_CONFIG_NAME env of the identity
+func (i Identity) Commander(base commander.Commander) commander.Commander {
+	if i == (Identity{}) {
+		return base
+	}
+	return identityCommander{identity: i, base: base}
+}
+
+// logFields returns the key value pairs logging the identity
+func (i Identity) logFields() []interface{} {
+	var fields []interface{}
+	if i.Account != "" {
+		fields = append(fields, "account", i.Account)
+	}
+	if i.Configuration != "" {
+		fields = append(fields, "configuration", i.Configuration)
+	}
+	if i.ImpersonateServiceAccount != "" {
+		fields = append(fields, "impersonateServiceAccount", i.ImpersonateServiceAccount)
+	}
+	return fields
+}
+
+type identityCommander struct {
+	identity Identity
+	base     commander.Commander
+}
+
+func (c identityCommander) Execute(ctx context.Context, cmdStr string, args []string, envs []string) (string, error) {
+	if cmdStr == "gcloud" {
+		if c.identity.Account != "" {
+			args = append(append([]string{}, args...), "--account="+c.identity.Account)
+		}
+		if c.identity.ImpersonateServiceAccount != "" {
+			args = append(append([]string{}, args...), "--impersonate-service-account="+c.identity.ImpersonateServiceAccount)
+		}
+		if c.identity.Configuration != "" {
+			envs = append(append([]string{}, envs...), "CLOUDSDK_ACTIVE_CONFIG_NAME="+c.identity.Configuration)
+		}
+	}
+	return c.base.Execute(ctx, cmdStr, args, envs)
+}
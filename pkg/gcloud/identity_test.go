@@ -0,0 +1,38 @@
+package gcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+func TestIdentity_Commander(t *testing.T) {
+	t.Run("should run gcloud commands with the account, configuration and service account of the identity", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		base := mock.NewCommander(ctrl)
+		base.EXPECT().Execute(gomock.Any(), "gcloud", []string{"projects", "list", "--format=json", "--account=test@example.com", "--impersonate-service-account=admin@test-project.iam.gserviceaccount.com"}, []string{"LANG=C", "CLOUDSDK_ACTIVE_CONFIG_NAME=work"}).Return("[]", nil)
+		base.EXPECT().Execute(gomock.Any(), "kubectl", []string{"version"}, nil).Return("", nil)
+		identity := IdentityOf(kubetmuxp.Project{Account: "test@example.com", GCloudConfiguration: "work", ImpersonateServiceAccount: "admin@test-project.iam.gserviceaccount.com"})
+		args := []string{"projects", "list", "--format=json"}
+
+		_, err := identity.Commander(base).Execute(context.Background(), "gcloud", args, []string{"LANG=C"})
+		assert.Nil(t, err)
+		_, err = identity.Commander(base).Execute(context.Background(), "kubectl", []string{"version"}, nil)
+		assert.Nil(t, err)
+
+		assert.Equal(t, []string{"projects", "list", "--format=json"}, args)
+	})
+
+	t.Run("should return the base commander for the active identity", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		base := mock.NewCommander(ctrl)
+
+		assert.Equal(t, base, Identity{}.Commander(base))
+	})
+}
@@ -0,0 +1,170 @@
+package gcloud
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+// ClusterLookup finds GKE clusters among the clusters listed for their
+// project, so that kubeconfigs can be written without running gcloud for
+// each cluster. The clusters of a project are listed at most once per
+// identity they are listed with. The clusters of the projects that cannot
+// be listed are found with gcloud container clusters get-credentials.
+type ClusterLookup struct {
+	cmdr commander.Commander
+
+	mu       sync.Mutex
+	projects map[listing]Clusters
+	denied   map[listing]error
+}
+
+// listing identifies the clusters of a project listed with an identity
+type listing struct {
+	projectID string
+	identity  Identity
+}
+
+// NewClusterLookup creates a ClusterLookup listing clusters with cmdr
+func NewClusterLookup(cmdr commander.Commander) *ClusterLookup {
+	return &ClusterLookup{cmdr: cmdr, projects: map[listing]Clusters{}, denied: map[listing]error{}}
+}
+
+// Add records the clusters already listed for the project with the identity
+func (l *ClusterLookup) Add(projectID string, identity Identity, clusters Clusters) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.projects[listing{projectID: projectID, identity: identity}] = clusters
+}
+
+// Listed tells if the cluster with the given name and location is among
+// the clusters already listed for the project with any identity, without
+// listing them
+func (l *ClusterLookup) Listed(projectID string, name string, location string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, clusters := range l.projects {
+		if key.projectID != projectID {
+			continue
+		}
+		for _, cluster := range clusters {
+			if cluster.Name == name && cluster.Location == location {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lookup returns what a kubeconfig needs to connect to the cluster with
+// the given name and location in the project through the given endpoint,
+// listing the clusters of the project with its identity if they were not
+// listed already. Like gcloud container clusters get-credentials with
+// --dns-endpoint, the DNS endpoint is trusted without the cluster CA.
+// When listing the clusters is denied, the cluster is found with
+// get-credentials, which needs only the container.clusters.get permission.
+func (l *ClusterLookup) Lookup(ctx context.Context, project kubetmuxp.Project, name string, location string, endpoint string) (kubeconfig.GKECluster, error) {
+	projectID := project.Name
+	clusters, err := l.clusters(ctx, projectID, IdentityOf(project))
+	if permissionDenied(err) {
+		return l.getCredentials(ctx, project, name, location, endpoint)
+	}
+	if err != nil {
+		return kubeconfig.GKECluster{}, err
+	}
+	for _, cluster := range clusters {
+		if cluster.Name != name || cluster.Location != location {
+			continue
+		}
+		gkeCluster := kubeconfig.GKECluster{Endpoint: cluster.Endpoint, CACertificate: cluster.MasterAuth.ClusterCaCertificate}
+		switch endpoint {
+		case kubetmuxp.InternalEndpoint:
+			gkeCluster.Endpoint = cluster.PrivateClusterConfig.PrivateEndpoint
+		case kubetmuxp.DNSEndpoint:
+			gkeCluster = kubeconfig.GKECluster{Endpoint: cluster.ControlPlaneEndpointsConfig.DNSEndpointConfig.Endpoint}
+		}
+		if gkeCluster.Endpoint == "" && endpoint != kubetmuxp.PublicEndpoint {
+			return kubeconfig.GKECluster{}, fmt.Errorf("cluster %s in %s of project %s has no %s endpoint", name, location, projectID, endpoint)
+		}
+		if gkeCluster.Endpoint == "" {
+			return kubeconfig.GKECluster{}, fmt.Errorf("cluster %s in %s of project %s has no endpoint yet", name, location, projectID)
+		}
+		return gkeCluster, nil
+	}
+	return kubeconfig.GKECluster{}, fmt.Errorf("cluster %s not found in %s of project %s", name, location, projectID)
+}
+
+func (l *ClusterLookup) clusters(ctx context.Context, projectID string, identity Identity) (Clusters, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := listing{projectID: projectID, identity: identity}
+	if clusters, ok := l.projects[key]; ok {
+		return clusters, nil
+	}
+	if err, ok := l.denied[key]; ok {
+		return nil, err
+	}
+	clusters, err := ListClusters(ctx, identity.Commander(l.cmdr), projectID)
+	if permissionDenied(err) {
+		l.denied[key] = err
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.projects[key] = clusters
+	return clusters, nil
+}
+
+// getCredentials finds the cluster from the kubeconfig that gcloud
+// container clusters get-credentials writes for it. As gcloud writes it
+// itself, it goes to a temporary file on disk, even for dry runs.
+func (l *ClusterLookup) getCredentials(ctx context.Context, project kubetmuxp.Project, name string, location string, endpoint string) (kubeconfig.GKECluster, error) {
+	dir, err := ioutil.TempDir("", "kube-tmuxp-")
+	if err != nil {
+		return kubeconfig.GKECluster{}, err
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "kubeconfig")
+
+	args := []string{"container", "clusters", "get-credentials", name, "--location=" + location, "--project", project.Name}
+	switch endpoint {
+	case kubetmuxp.InternalEndpoint:
+		args = append(args, "--internal-ip")
+	case kubetmuxp.DNSEndpoint:
+		args = append(args, "--dns-endpoint")
+	}
+	if _, err := IdentityOf(project).Commander(l.cmdr).Execute(ctx, "gcloud", args, []string{"KUBECONFIG=" + file}); err != nil {
+		return kubeconfig.GKECluster{}, fmt.Errorf("error getting credentials of cluster %s in %s of project %s: %w", name, location, project.Name, err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return kubeconfig.GKECluster{}, err
+	}
+	kubeCfg, err := kubeconfig.Parse(data)
+	if err != nil {
+		return kubeconfig.GKECluster{}, fmt.Errorf("error parsing the kubeconfig of cluster %s in %s of project %s: %v", name, location, project.Name, err)
+	}
+	cluster, _, err := kubeCfg.Current()
+	if err != nil {
+		return kubeconfig.GKECluster{}, err
+	}
+	return kubeconfig.GKECluster{Endpoint: strings.TrimPrefix(cluster.Server, "https://"), CACertificate: cluster.CertificateAuthorityData}, nil
+}
+
+// permissionDenied tells if gcloud failed because the
+// account lacks a permission, like container.clusters.list
+func permissionDenied(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "code=403") || strings.Contains(err.Error(), "PERMISSION_DENIED"))
+}
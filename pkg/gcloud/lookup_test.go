@@ -0,0 +1,165 @@
+package gcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+func TestClusterLookup(t *testing.T) {
+	project := kubetmuxp.Project{Name: "test-project"}
+
+	t.Run("should return the endpoint and CA certificate of clusters listed once per project", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json"}, nil).Return(`[
+  {"name": "zonal", "location": "test-zone", "endpoint": "10.0.0.1", "masterAuth": {"clusterCaCertificate": "Y2EtZGF0YQ=="}},
+  {"name": "regional", "location": "test-region", "endpoint": "10.0.0.2", "masterAuth": {"clusterCaCertificate": "Y2EtZGF0YQ=="}}
+]`, nil).Times(1)
+		lookup := NewClusterLookup(commander)
+
+		zonal, err := lookup.Lookup(context.Background(), project, "zonal", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.Nil(t, err)
+		regional, err := lookup.Lookup(context.Background(), project, "regional", "test-region", kubetmuxp.PublicEndpoint)
+		assert.Nil(t, err)
+
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.1", CACertificate: "Y2EtZGF0YQ=="}, zonal)
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.2", CACertificate: "Y2EtZGF0YQ=="}, regional)
+	})
+
+	t.Run("should list the clusters with the account and configuration of the project", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json", "--account=test@example.com"}, []string{"CLOUDSDK_ACTIVE_CONFIG_NAME=work"}).Return(`[
+  {"name": "zonal", "location": "test-zone", "endpoint": "10.0.0.1"}
+]`, nil)
+		lookup := NewClusterLookup(commander)
+
+		cluster, err := lookup.Lookup(context.Background(), kubetmuxp.Project{Name: "test-project", Account: "test@example.com", GCloudConfiguration: "work"}, "zonal", "test-zone", kubetmuxp.PublicEndpoint)
+
+		assert.Nil(t, err)
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.1"}, cluster)
+	})
+
+	t.Run("should return the internal or DNS endpoint of the cluster", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		lookup := NewClusterLookup(mock.NewCommander(ctrl))
+		lookup.Add("test-project", Identity{}, Clusters{{
+			Name:                        "private",
+			Location:                    "test-zone",
+			Endpoint:                    "34.0.0.1",
+			MasterAuth:                  MasterAuth{ClusterCaCertificate: "Y2EtZGF0YQ=="},
+			PrivateClusterConfig:        PrivateClusterConfig{PrivateEndpoint: "10.0.0.1"},
+			ControlPlaneEndpointsConfig: ControlPlaneEndpointsConfig{DNSEndpointConfig: DNSEndpointConfig{Endpoint: "gke-1234.test-zone.gke.goog"}},
+		}})
+
+		internal, err := lookup.Lookup(context.Background(), project, "private", "test-zone", kubetmuxp.InternalEndpoint)
+		assert.Nil(t, err)
+		dns, err := lookup.Lookup(context.Background(), project, "private", "test-zone", kubetmuxp.DNSEndpoint)
+		assert.Nil(t, err)
+
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.1", CACertificate: "Y2EtZGF0YQ=="}, internal)
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "gke-1234.test-zone.gke.goog"}, dns)
+	})
+
+	t.Run("should parse the internal and DNS endpoints of listed clusters", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json"}, nil).Return(`[
+  {"name": "private", "location": "test-zone", "endpoint": "34.0.0.1", "privateClusterConfig": {"enablePrivateNodes": true, "privateEndpoint": "10.0.0.1"}, "controlPlaneEndpointsConfig": {"dnsEndpointConfig": {"allowExternalTraffic": true, "endpoint": "gke-1234.test-zone.gke.goog"}}}
+]`, nil)
+		lookup := NewClusterLookup(commander)
+
+		cluster, err := lookup.Lookup(context.Background(), project, "private", "test-zone", kubetmuxp.DNSEndpoint)
+
+		assert.Nil(t, err)
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "gke-1234.test-zone.gke.goog"}, cluster)
+	})
+
+	t.Run("should list the clusters of a project again for clusters impersonating another service account", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		commander := mock.NewCommander(ctrl)
+		commander.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json", "--impersonate-service-account=admin@test-project.iam.gserviceaccount.com"}, nil).Return(`[
+  {"name": "restricted", "location": "test-zone", "endpoint": "10.0.0.2"}
+]`, nil)
+		lookup := NewClusterLookup(commander)
+		lookup.Add("test-project", Identity{}, Clusters{{Name: "zonal", Location: "test-zone", Endpoint: "10.0.0.1"}})
+
+		zonal, err := lookup.Lookup(context.Background(), project, "zonal", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.Nil(t, err)
+		restricted, err := lookup.Lookup(context.Background(), kubetmuxp.Project{Name: "test-project", ImpersonateServiceAccount: "admin@test-project.iam.gserviceaccount.com"}, "restricted", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.Nil(t, err)
+
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.1"}, zonal)
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.2"}, restricted)
+		assert.True(t, lookup.Listed("test-project", "restricted", "test-zone"))
+	})
+
+	t.Run("should get the credentials of each cluster when listing the clusters is denied", func(t *testing.T) {
+		cli := fakecli.New(fakecli.Fixture{Projects: []fakecli.Project{{
+			ProjectID: "test-project",
+			DenyList:  true,
+			Clusters: []fakecli.Cluster{
+				{Name: "zonal", Location: "test-zone", Endpoint: "10.0.0.1"},
+				{Name: "regional", Location: "test-region", Endpoint: "10.0.0.2"},
+			},
+		}}})
+		lookup := NewClusterLookup(cli)
+
+		zonal, err := lookup.Lookup(context.Background(), project, "zonal", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.Nil(t, err)
+		regional, err := lookup.Lookup(context.Background(), kubetmuxp.Project{Name: "test-project", Account: "test@example.com"}, "regional", "test-region", kubetmuxp.InternalEndpoint)
+		assert.Nil(t, err)
+
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.1", CACertificate: "Y2Egb2YgZ2tlX3Rlc3QtcHJvamVjdF90ZXN0LXpvbmVfem9uYWw="}, zonal)
+		assert.Equal(t, "10.0.0.2", regional.Endpoint)
+		assert.Equal(t, []string{
+			"gcloud container clusters list --project test-project --format=json",
+			"gcloud container clusters get-credentials zonal --location=test-zone --project test-project",
+			"gcloud container clusters list --project test-project --format=json --account=test@example.com",
+			"gcloud container clusters get-credentials regional --location=test-region --project test-project --internal-ip --account=test@example.com",
+		}, cli.Calls())
+		_, err = lookup.Lookup(context.Background(), project, "zonal", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.Nil(t, err)
+		assert.Len(t, cli.Calls(), 5)
+	})
+
+	t.Run("should not list the clusters of projects that were added", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		lookup := NewClusterLookup(mock.NewCommander(ctrl))
+		lookup.Add("test-project", Identity{}, Clusters{{Name: "zonal", Location: "test-zone", Endpoint: "10.0.0.1"}})
+
+		cluster, err := lookup.Lookup(context.Background(), project, "zonal", "test-zone", kubetmuxp.PublicEndpoint)
+
+		assert.Nil(t, err)
+		assert.Equal(t, kubeconfig.GKECluster{Endpoint: "10.0.0.1"}, cluster)
+	})
+
+	t.Run("should return error if the cluster is missing or has no endpoint", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		lookup := NewClusterLookup(mock.NewCommander(ctrl))
+		lookup.Add("test-project", Identity{}, Clusters{{Name: "provisioning", Location: "test-zone"}})
+
+		_, err := lookup.Lookup(context.Background(), project, "unknown", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.EqualError(t, err, "cluster unknown not found in test-zone of project test-project")
+
+		_, err = lookup.Lookup(context.Background(), project, "provisioning", "test-zone", kubetmuxp.PublicEndpoint)
+		assert.EqualError(t, err, "cluster provisioning in test-zone of project test-project has no endpoint yet")
+
+		_, err = lookup.Lookup(context.Background(), project, "provisioning", "test-zone", kubetmuxp.InternalEndpoint)
+		assert.EqualError(t, err, "cluster provisioning in test-zone of project test-project has no internal endpoint")
+	})
+}
@@ -0,0 +1,66 @@
+package gcloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+)
+
+// ProjectScope narrows the projects listed by gcloud to the ones in
+// an organization or a folder, including the folders in them, and to
+// the ones matching a gcloud filter expression. Its zero value lists
+// every project.
+type ProjectScope struct {
+	Organization string
+	Folder       string
+	Filter       string
+}
+
+// NewProjectScope creates a ProjectScope of the projects in the
+// organization or in the folder which match the filter expression,
+// like labels.env=prod. Empty arguments do not narrow the scope.
+func NewProjectScope(organization, folder, filter string) (ProjectScope, error) {
+	if organization != "" && folder != "" {
+		return ProjectScope{}, fmt.Errorf("invalid project scope: only one of organization and folder can be given")
+	}
+	return ProjectScope{
+		Organization: strings.TrimPrefix(organization, "organizations/"),
+		Folder:       strings.TrimPrefix(folder, "folders/"),
+		Filter:       filter,
+	}, nil
+}
+
+// Expression returns the gcloud filter expression selecting the projects
+// of the scope. The folders in its organization or folder are listed
+// recursively as gcloud only filters projects by their direct parent.
+func (s ProjectScope) Expression(ctx context.Context, cmdr commander.Commander) (string, error) {
+	var root string
+	switch {
+	case s.Organization != "":
+		root = "organizations/" + s.Organization
+	case s.Folder != "":
+		root = "folders/" + s.Folder
+	default:
+		return s.Filter, nil
+	}
+
+	parentIDs := []string{strings.SplitN(root, "/", 2)[1]}
+	for parents := []string{root}; len(parents) > 0; parents = parents[1:] {
+		folders, err := ListFolders(ctx, cmdr, parents[0])
+		if err != nil {
+			return "", err
+		}
+		for _, folder := range folders {
+			parentIDs = append(parentIDs, folder.ID())
+			parents = append(parents, folder.Name)
+		}
+	}
+
+	expression := fmt.Sprintf("parent.id=(%s)", strings.Join(parentIDs, " "))
+	if s.Filter != "" {
+		expression += fmt.Sprintf(" AND (%s)", s.Filter)
+	}
+	return expression, nil
+}
@@ -0,0 +1,68 @@
+package gcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+)
+
+var scopeFixture = fakecli.Fixture{
+	Folders: []fakecli.Folder{
+		{ID: "10", Parent: "organizations/1"},
+		{ID: "11", Parent: "organizations/1"},
+		{ID: "20", Parent: "folders/10"},
+	},
+}
+
+func TestNewProjectScope(t *testing.T) {
+	t.Run("should accept IDs with or without their resource prefix", func(t *testing.T) {
+		scope, err := NewProjectScope("organizations/1", "", "labels.env=prod")
+
+		assert.Nil(t, err)
+		assert.Equal(t, ProjectScope{Organization: "1", Filter: "labels.env=prod"}, scope)
+	})
+
+	t.Run("should return error when both organization and folder are given", func(t *testing.T) {
+		_, err := NewProjectScope("1", "10", "")
+
+		assert.EqualError(t, err, "invalid project scope: only one of organization and folder can be given")
+	})
+}
+
+func TestProjectScope_Expression(t *testing.T) {
+	t.Run("should return the filter when there is no organization or folder", func(t *testing.T) {
+		cli := fakecli.New(scopeFixture)
+
+		expression, err := ProjectScope{Filter: "labels.env=prod"}.Expression(context.Background(), cli)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "labels.env=prod", expression)
+		assert.Empty(t, cli.Calls())
+	})
+
+	t.Run("should select the projects in the organization and all its folders", func(t *testing.T) {
+		cli := fakecli.New(scopeFixture)
+
+		expression, err := ProjectScope{Organization: "1", Filter: "labels.env=prod"}.Expression(context.Background(), cli)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "parent.id=(1 10 11 20) AND (labels.env=prod)", expression)
+		assert.Equal(t, []string{
+			"gcloud resource-manager folders list --organization=1 --format=json",
+			"gcloud resource-manager folders list --folder=10 --format=json",
+			"gcloud resource-manager folders list --folder=11 --format=json",
+			"gcloud resource-manager folders list --folder=20 --format=json",
+		}, cli.Calls())
+	})
+
+	t.Run("should select the projects in the folder and its subfolders", func(t *testing.T) {
+		cli := fakecli.New(scopeFixture)
+
+		expression, err := ProjectScope{Folder: "10"}.Expression(context.Background(), cli)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "parent.id=(10 20)", expression)
+	})
+}
@@ -1,55 +1,165 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/file"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 )
 
+// Sources are the sources from which configs can be generated
+var Sources = []string{"file", "gcloud"}
+
 type Generator interface {
-	Generate(outStream, errStream io.Writer)
+	// Generate writes its machine readable output to out
+	// and logs its progress
+	Generate(ctx context.Context, out io.Writer)
 }
 
 type Options struct {
 	From           string
 	AllProjects    bool
 	ProjectIDs     []string
+	Organization   string
+	Folder         string
+	ProjectFilter  string
+	Accounts       []string
+	Configurations []string
 	AdditionalEnvs []string
+	ClusterFilter  string
+	ClusterLabels  []string
+	Statuses       []string
+	ClusterIDs     []string
+	MergeInto      string
+	Concurrency    int
+	Cache          *gcloud.Cache
+	Refresh        bool
 	Apply          bool
 	CfgFile        string
+	Watch          bool
+	Force          bool
+	Wait           bool
+	DryRun         bool
+	Output         kubetmuxp.Output
 }
 
-func NewGenerator(options Options, fs filesystem.FileSystem, cmdr commander.Commander) (Generator, error) {
+func NewGenerator(options Options, fs filesystem.FileSystem, cmdr commander.Commander, log *logging.Logger) (Generator, error) {
 	switch options.From {
 	case "file":
-		if err := areFlagsValidForSourceFile(options.AllProjects, options.ProjectIDs, options.AdditionalEnvs); err != nil {
+		if err := areFlagsValidForSourceFile(options); err != nil {
 			return nil, fmt.Errorf("error in the flags for source type 'file': %s", err)
 		}
-		return file.NewGenerator(fs, cmdr, options.CfgFile), nil
+		if options.Watch && options.DryRun {
+			return nil, fmt.Errorf("error in the flags for source type 'file': watch cannot be used with dry-run")
+		}
+		return file.NewGenerator(file.Options{
+			CfgFile: options.CfgFile,
+			Watch:   options.Watch,
+			Force:   options.Force,
+			Wait:    options.Wait,
+			DryRun:  options.DryRun,
+			Output:  options.Output,
+		}, fs, cmdr, log), nil
 	case "gcloud":
-		return gcloud.NewGenerator(options.ProjectIDs, options.AllProjects, options.AdditionalEnvs, options.Apply), nil
+		if options.Watch {
+			return nil, fmt.Errorf("error in the flags for source type 'gcloud': watch is supported only for source file")
+		}
+		return gcloud.NewGenerator(gcloud.Options{
+			ProjectIDs:     options.ProjectIDs,
+			AllProjects:    options.AllProjects,
+			Organization:   options.Organization,
+			Folder:         options.Folder,
+			ProjectFilter:  options.ProjectFilter,
+			Accounts:       options.Accounts,
+			Configurations: options.Configurations,
+			AdditionalEnvs: options.AdditionalEnvs,
+			ClusterFilter:  options.ClusterFilter,
+			ClusterLabels:  options.ClusterLabels,
+			Statuses:       options.Statuses,
+			ClusterIDs:     options.ClusterIDs,
+			MergeInto:      options.MergeInto,
+			Concurrency:    options.Concurrency,
+			Cache:          options.Cache,
+			Refresh:        options.Refresh,
+			Apply:          options.Apply,
+			Force:          options.Force,
+			Wait:           options.Wait,
+			DryRun:         options.DryRun,
+			Output:         options.Output,
+		}, fs, cmdr, log), nil
 	default:
-		return nil, fmt.Errorf("invalid source provided: valid sources are file,gcloud")
+		return nil, fmt.Errorf("invalid source provided: valid sources are %s", strings.Join(Sources, ","))
 	}
 }
 
-func areFlagsValidForSourceFile(allProjects bool, projectIDs, additionalEnvs []string) error {
+func areFlagsValidForSourceFile(options Options) error {
 	err := ""
 	counter := 1
-	if projectIDs != nil {
+	if options.ProjectIDs != nil {
 		err += fmt.Sprintf("\n %d) %s", counter, "project-ids should be empty for source file")
 		counter++
 	}
-	if allProjects {
+	if options.AllProjects {
 		err += fmt.Sprintf("\n %d) %s", counter, "all-projects should be false for source file")
 		counter++
 	}
-	if additionalEnvs != nil {
+	if options.Organization != "" {
+		err += fmt.Sprintf("\n %d) %s", counter, "organization should be empty for source file")
+		counter++
+	}
+	if options.Folder != "" {
+		err += fmt.Sprintf("\n %d) %s", counter, "folder should be empty for source file")
+		counter++
+	}
+	if options.ProjectFilter != "" {
+		err += fmt.Sprintf("\n %d) %s", counter, "project-filter should be empty for source file")
+		counter++
+	}
+	if options.Accounts != nil {
+		err += fmt.Sprintf("\n %d) %s", counter, "accounts should be empty for source file")
+		counter++
+	}
+	if options.Configurations != nil {
+		err += fmt.Sprintf("\n %d) %s", counter, "gcloud-configurations should be empty for source file")
+		counter++
+	}
+	if options.AdditionalEnvs != nil {
 		err += fmt.Sprintf("\n %d) %s", counter, "additional-envs should be empty for source file")
+		counter++
+	}
+	if options.ClusterFilter != "" {
+		err += fmt.Sprintf("\n %d) %s", counter, "cluster-filter should be empty for source file")
+		counter++
+	}
+	if options.ClusterLabels != nil {
+		err += fmt.Sprintf("\n %d) %s", counter, "cluster-labels should be empty for source file")
+		counter++
+	}
+	if options.Statuses != nil {
+		err += fmt.Sprintf("\n %d) %s", counter, "status should be empty for source file")
+		counter++
+	}
+	if options.ClusterIDs != nil {
+		err += fmt.Sprintf("\n %d) %s", counter, "cluster-ids should be empty for source file")
+		counter++
+	}
+	if options.MergeInto != "" {
+		err += fmt.Sprintf("\n %d) %s", counter, "merge-into should be empty for source file")
+		counter++
+	}
+	if options.Concurrency != 0 {
+		err += fmt.Sprintf("\n %d) %s", counter, "concurrency should not be set for source file")
+		counter++
+	}
+	if options.Refresh {
+		err += fmt.Sprintf("\n %d) %s", counter, "refresh should be false for source file")
 	}
 
 	if err != "" {
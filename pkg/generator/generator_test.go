@@ -11,30 +11,72 @@ import (
 func TestNewGenerator(t *testing.T) {
 
 	t.Run("should fail if invalid from source is given", func(t *testing.T) {
-		generator, err := NewGenerator(Options{From: "invalid"}, nil, nil)
+		generator, err := NewGenerator(Options{From: "invalid"}, nil, nil, nil)
 
 		assert.EqualError(t, err, "invalid source provided: valid sources are file,gcloud")
 		assert.Nil(t, generator)
 	})
 
 	t.Run("should create gcloud generator for gcloud option", func(t *testing.T) {
-		generator, err := NewGenerator(Options{From: "gcloud"}, nil, nil)
+		generator, err := NewGenerator(Options{From: "gcloud"}, nil, nil, nil)
 
 		assert.Nil(t, err)
-		assert.Equal(t, generator, gcloud.NewGenerator(nil, false, nil, false))
+		assert.Equal(t, generator, gcloud.NewGenerator(gcloud.Options{}, nil, nil, nil))
+	})
+
+	t.Run("should fail if watch is given for gcloud option", func(t *testing.T) {
+		generator, err := NewGenerator(Options{From: "gcloud", Watch: true}, nil, nil, nil)
+
+		assert.Nil(t, generator)
+		assert.EqualError(t, err, "error in the flags for source type 'gcloud': watch is supported only for source file")
+	})
+
+	t.Run("should create file generator with watch for file option", func(t *testing.T) {
+		generator, err := NewGenerator(Options{From: "file", Watch: true, CfgFile: "config.yaml"}, nil, nil, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, generator, file.NewGenerator(file.Options{CfgFile: "config.yaml", Watch: true}, nil, nil, nil))
+	})
+
+	t.Run("should fail if watch is given with dry run", func(t *testing.T) {
+		generator, err := NewGenerator(Options{From: "file", Watch: true, DryRun: true}, nil, nil, nil)
+
+		assert.Nil(t, generator)
+		assert.EqualError(t, err, "error in the flags for source type 'file': watch cannot be used with dry-run")
 	})
 
 	t.Run("should create file generator if options are valid", func(t *testing.T) {
-		generator, err := NewGenerator(Options{From: "file"}, nil, nil)
+		generator, err := NewGenerator(Options{From: "file"}, nil, nil, nil)
 
 		assert.Nil(t, err)
-		assert.Equal(t, generator, file.NewGenerator(nil, nil, ""))
+		assert.Equal(t, generator, file.NewGenerator(file.Options{}, nil, nil, nil))
 	})
 
 	t.Run("should fail if if options are invalid for file generator", func(t *testing.T) {
-		generator, err := NewGenerator(Options{From: "file", AllProjects: true, ProjectIDs: []string{"project1"}, AdditionalEnvs: []string{"a=1"}}, nil, nil)
+		generator, err := NewGenerator(Options{From: "file", AllProjects: true, ProjectIDs: []string{"project1"}, AdditionalEnvs: []string{"a=1"}}, nil, nil, nil)
 
 		assert.Nil(t, generator)
 		assert.EqualError(t, err, "error in the flags for source type 'file': \n 1) project-ids should be empty for source file\n 2) all-projects should be false for source file\n 3) additional-envs should be empty for source file\n")
 	})
+
+	t.Run("should fail if the project scope is given for file generator", func(t *testing.T) {
+		generator, err := NewGenerator(Options{From: "file", Organization: "123", Folder: "456", ProjectFilter: "labels.env=prod"}, nil, nil, nil)
+
+		assert.Nil(t, generator)
+		assert.EqualError(t, err, "error in the flags for source type 'file': \n 1) organization should be empty for source file\n 2) folder should be empty for source file\n 3) project-filter should be empty for source file\n")
+	})
+
+	t.Run("should fail if gcloud accounts or configurations are given for file generator", func(t *testing.T) {
+		generator, err := NewGenerator(Options{From: "file", Accounts: []string{"me@example.com"}, Configurations: []string{"work"}}, nil, nil, nil)
+
+		assert.Nil(t, generator)
+		assert.EqualError(t, err, "error in the flags for source type 'file': \n 1) accounts should be empty for source file\n 2) gcloud-configurations should be empty for source file\n")
+	})
+
+	t.Run("should fail if cluster filters are given for file generator", func(t *testing.T) {
+		generator, err := NewGenerator(Options{From: "file", ClusterFilter: "^prod-", ClusterLabels: []string{"env=prod"}, Statuses: []string{"RUNNING"}, ClusterIDs: []string{"project/zone/cluster"}, MergeInto: "config.yaml", Concurrency: 4, Refresh: true}, nil, nil, nil)
+
+		assert.Nil(t, generator)
+		assert.EqualError(t, err, "error in the flags for source type 'file': \n 1) cluster-filter should be empty for source file\n 2) cluster-labels should be empty for source file\n 3) status should be empty for source file\n 4) cluster-ids should be empty for source file\n 5) merge-into should be empty for source file\n 6) concurrency should not be set for source file\n 7) refresh should be false for source file\n")
+	})
 }
@@ -0,0 +1,320 @@
+// Package fakecli emulates the gcloud commands used by
+// kube-tmuxp so that it can be tested end to end without a GCP account
+package fakecli
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Fixture describes the account, folders, projects and clusters the fake
+// gcloud knows about. Configurations maps the gcloud configurations to
+// their account, the active one being Account.
+type Fixture struct {
+	Account        string            `yaml:"account"`
+	Configurations map[string]string `yaml:"configurations"`
+	Folders        []Folder          `yaml:"folders"`
+	Projects       []Project         `yaml:"projects"`
+}
+
+// Folder is a GCP folder of a Fixture, whose parent
+// is either organizations/<id> or folders/<id>
+type Folder struct {
+	ID     string `yaml:"id"`
+	Parent string `yaml:"parent"`
+}
+
+// Project is a GCP project of a Fixture, whose parent is either
+// organizations/<id> or folders/<id>. Only the given accounts can
+// see it, if any. The clusters of a project with DenyList cannot be
+// listed, only fetched one by one with get-credentials.
+type Project struct {
+	ProjectID string            `yaml:"projectId"`
+	Name      string            `yaml:"name"`
+	Labels    map[string]string `yaml:"labels"`
+	Parent    string            `yaml:"parent"`
+	Accounts  []string          `yaml:"accounts"`
+	DenyList  bool              `yaml:"denyList"`
+	Clusters  []Cluster         `yaml:"clusters"`
+}
+
+// Cluster is a GKE cluster of a Project. Clusters whose location is
+// not one of their locations are regional. Status defaults to RUNNING.
+type Cluster struct {
+	Name           string            `yaml:"name"`
+	Location       string            `yaml:"location"`
+	Locations      []string          `yaml:"locations"`
+	Endpoint       string            `yaml:"endpoint"`
+	Status         string            `yaml:"status"`
+	ResourceLabels map[string]string `yaml:"resourceLabels"`
+}
+
+// LoadFixture reads a Fixture from the given YAML file
+func LoadFixture(file string) (Fixture, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Fixture{}, err
+	}
+	var fixture Fixture
+	if err := yaml.UnmarshalStrict(data, &fixture); err != nil {
+		return Fixture{}, fmt.Errorf("error parsing fixture %s: %v", file, err)
+	}
+	return fixture, nil
+}
+
+// CLI is a commander.Commander that emulates gcloud for the
+// projects and clusters of a Fixture
+type CLI struct {
+	fixture Fixture
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// New creates a CLI for the given fixture
+func New(fixture Fixture) *CLI {
+	return &CLI{fixture: fixture}
+}
+
+// Calls returns the commands executed so far, without their envs
+func (c *CLI) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.calls...)
+}
+
+// Execute emulates the given gcloud command, run with the account
+// of --account or else of the CLOUDSDK_ACTIVE_CONFIG_NAME env
+func (c *CLI) Execute(_ context.Context, cmdStr string, args []string, envs []string) (string, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, strings.Join(append([]string{cmdStr}, args...), " "))
+	c.mu.Unlock()
+
+	command := strings.Join(append([]string{cmdStr}, positional(args)...), " ")
+	flags := flagValues(args)
+	account := c.account(flags["account"], envs)
+
+	switch {
+	case command == "gcloud config get-value account":
+		return account, nil
+	case command == "gcloud projects list":
+		return c.listProjects(account, flags["filter"])
+	case command == "gcloud resource-manager folders list" && flags["organization"] != "":
+		return c.listFolders("organizations/" + flags["organization"])
+	case command == "gcloud resource-manager folders list" && flags["folder"] != "":
+		return c.listFolders("folders/" + flags["folder"])
+	case command == "gcloud container clusters list":
+		return c.listClusters(account, flags["project"])
+	case strings.HasPrefix(command, "gcloud container clusters get-credentials "):
+		return "", c.getCredentials(account, flags["project"], strings.TrimPrefix(command, "gcloud container clusters get-credentials "), flags["location"], envs)
+	default:
+		return "", fmt.Errorf("fakecli: unexpected command %s", strings.Join(append([]string{cmdStr}, args...), " "))
+	}
+}
+
+// account returns the account of the flag, or else of the
+// configuration activated by the envs, or else the active one
+func (c *CLI) account(flag string, envs []string) string {
+	if flag != "" {
+		return flag
+	}
+	for _, env := range envs {
+		if strings.HasPrefix(env, "CLOUDSDK_ACTIVE_CONFIG_NAME=") {
+			return c.fixture.Configurations[strings.TrimPrefix(env, "CLOUDSDK_ACTIVE_CONFIG_NAME=")]
+		}
+	}
+	return c.fixture.Account
+}
+
+// listProjects lists the projects the account can see matching the gcloud
+// filter expression, if any, along with their name, labels and parent
+func (c *CLI) listProjects(account, expression string) (string, error) {
+	matches := func(map[string]string) bool { return true }
+	if expression != "" {
+		f, err := parseFilter(expression)
+		if err != nil {
+			return "", err
+		}
+		matches = f
+	}
+	projects := make([]map[string]interface{}, 0, len(c.fixture.Projects))
+	for _, project := range c.fixture.Projects {
+		if !project.visibleTo(account) {
+			continue
+		}
+		fields := map[string]string{"projectId": project.ProjectID, "name": project.Name}
+		for key, value := range project.Labels {
+			fields["labels."+key] = value
+		}
+		entry := map[string]interface{}{"projectId": project.ProjectID}
+		if project.Name != "" {
+			entry["name"] = project.Name
+		}
+		if project.Labels != nil {
+			entry["labels"] = project.Labels
+		}
+		if parts := strings.SplitN(project.Parent, "/", 2); len(parts) == 2 {
+			parent := map[string]string{"type": strings.TrimSuffix(parts[0], "s"), "id": parts[1]}
+			fields["parent.type"], fields["parent.id"] = parent["type"], parent["id"]
+			entry["parent"] = parent
+		}
+		if matches(fields) {
+			projects = append(projects, entry)
+		}
+	}
+	return toJSON(projects)
+}
+
+// listFolders lists the folders directly in the parent
+func (c *CLI) listFolders(parent string) (string, error) {
+	folders := make([]map[string]string, 0, len(c.fixture.Folders))
+	for _, folder := range c.fixture.Folders {
+		if folder.Parent == parent {
+			folders = append(folders, map[string]string{"name": "folders/" + folder.ID, "displayName": folder.ID, "parent": folder.Parent})
+		}
+	}
+	return toJSON(folders)
+}
+
+// listClusters lists the clusters of the project along with their
+// endpoint and a CA certificate unique to their gcloud context name
+// gke_<project>_<location>_<name>
+func (c *CLI) listClusters(account, projectID string) (string, error) {
+	project, err := c.project(account, projectID)
+	if err != nil {
+		return "", err
+	}
+	if project.DenyList {
+		return "", fmt.Errorf(`ERROR: (gcloud.container.clusters.list) ResponseError: code=403, message=Required "container.clusters.list" permission(s) for "projects/%s".`, projectID)
+	}
+	clusters := make([]map[string]interface{}, 0, len(project.Clusters))
+	for _, cluster := range project.Clusters {
+		status := cluster.Status
+		if status == "" {
+			status = "RUNNING"
+		}
+		entry := map[string]interface{}{
+			"name":      cluster.Name,
+			"location":  cluster.Location,
+			"locations": cluster.Locations,
+			"endpoint":  cluster.Endpoint,
+			"masterAuth": map[string]string{
+				"clusterCaCertificate": base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("ca of gke_%s_%s_%s", projectID, cluster.Location, cluster.Name))),
+			},
+			"status": status,
+		}
+		if cluster.ResourceLabels != nil {
+			entry["resourceLabels"] = cluster.ResourceLabels
+		}
+		clusters = append(clusters, entry)
+	}
+	return toJSON(clusters)
+}
+
+// getCredentials writes the kubeconfig of the cluster, with the CA
+// certificate listClusters gives it, to the file of the KUBECONFIG env
+func (c *CLI) getCredentials(account, projectID, name, location string, envs []string) error {
+	project, err := c.project(account, projectID)
+	if err != nil {
+		return err
+	}
+	var file string
+	for _, env := range envs {
+		if strings.HasPrefix(env, "KUBECONFIG=") {
+			file = strings.TrimPrefix(env, "KUBECONFIG=")
+		}
+	}
+	for _, cluster := range project.Clusters {
+		if cluster.Name != name || cluster.Location != location {
+			continue
+		}
+		ctxName := fmt.Sprintf("gke_%s_%s_%s", projectID, location, name)
+		kubeconfig := map[string]interface{}{
+			"apiVersion":      "v1",
+			"kind":            "Config",
+			"current-context": ctxName,
+			"clusters": []map[string]interface{}{{"name": ctxName, "cluster": map[string]string{
+				"server":                     "https://" + cluster.Endpoint,
+				"certificate-authority-data": base64.StdEncoding.EncodeToString([]byte("ca of " + ctxName)),
+			}}},
+			"contexts": []map[string]interface{}{{"name": ctxName, "context": map[string]string{"cluster": ctxName, "user": ctxName}}},
+			"users":    []map[string]interface{}{{"name": ctxName, "user": map[string]interface{}{"exec": map[string]string{"command": "gke-gcloud-auth-plugin"}}}},
+		}
+		data, err := yaml.Marshal(kubeconfig)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, data, 0600)
+	}
+	return fmt.Errorf("ERROR: (gcloud.container.clusters.get-credentials) ResponseError: code=404, message=Not found: projects/%s/locations/%s/clusters/%s.", projectID, location, name)
+}
+
+func (c *CLI) project(account, projectID string) (Project, error) {
+	for _, project := range c.fixture.Projects {
+		if project.ProjectID == projectID && project.visibleTo(account) {
+			return project, nil
+		}
+	}
+	return Project{}, fmt.Errorf("ERROR: (gcloud.container.clusters) ResponseError: code=403, message=Project %s not found or permission denied", projectID)
+}
+
+func (p Project) visibleTo(account string) bool {
+	if len(p.Accounts) == 0 {
+		return true
+	}
+	for _, a := range p.Accounts {
+		if a == account {
+			return true
+		}
+	}
+	return false
+}
+
+// positional returns the args that are not flags, skipping the values
+// of flags given as separate args like --project my-project
+func positional(args []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--project":
+			i++
+		case strings.HasPrefix(args[i], "--"):
+		default:
+			result = append(result, args[i])
+		}
+	}
+	return result
+}
+
+func flagValues(args []string) map[string]string {
+	values := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		flag := strings.TrimPrefix(args[i], "--")
+		if parts := strings.SplitN(flag, "=", 2); len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		} else if flag == "project" && i+1 < len(args) {
+			values[flag] = args[i+1]
+			i++
+		}
+	}
+	return values
+}
+
+func toJSON(value interface{}) (string, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,118 @@
+package fakecli_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/fakecli"
+)
+
+var fixture = fakecli.Fixture{
+	Projects: []fakecli.Project{
+		{
+			ProjectID: "test-project",
+			Clusters: []fakecli.Cluster{
+				{Name: "test-cluster", Location: "test-zone", Locations: []string{"test-zone"}, Endpoint: "10.0.0.1"},
+			},
+		},
+	},
+}
+
+func TestExecute(t *testing.T) {
+	t.Run("should list projects and clusters", func(t *testing.T) {
+		cli := fakecli.New(fixture)
+
+		projects, err := cli.Execute(context.Background(), "gcloud", []string{"projects", "list", "--format=json"}, nil)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"projectId": "test-project"}]`, projects)
+
+		clusters, err := cli.Execute(context.Background(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json"}, nil)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"name": "test-cluster", "location": "test-zone", "locations": ["test-zone"], "endpoint": "10.0.0.1", "masterAuth": {"clusterCaCertificate": "Y2Egb2YgZ2tlX3Rlc3QtcHJvamVjdF90ZXN0LXpvbmVfdGVzdC1jbHVzdGVy"}, "status": "RUNNING"}]`, clusters)
+
+		assert.Equal(t, []string{
+			"gcloud projects list --format=json",
+			"gcloud container clusters list --project test-project --format=json",
+		}, cli.Calls())
+	})
+
+	t.Run("should list folders and the projects matching the filter", func(t *testing.T) {
+		cli := fakecli.New(fakecli.Fixture{
+			Folders: []fakecli.Folder{{ID: "10", Parent: "organizations/1"}, {ID: "20", Parent: "folders/10"}},
+			Projects: []fakecli.Project{
+				{ProjectID: "prod-project", Name: "Prod", Labels: map[string]string{"env": "prod"}, Parent: "folders/20"},
+				{ProjectID: "dev-project", Labels: map[string]string{"env": "dev"}, Parent: "folders/20"},
+				{ProjectID: "other-project", Labels: map[string]string{"env": "prod"}, Parent: "organizations/2"},
+			},
+		})
+
+		folders, err := cli.Execute(context.Background(), "gcloud", []string{"resource-manager", "folders", "list", "--folder=10", "--format=json"}, nil)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"name": "folders/20", "displayName": "20", "parent": "folders/10"}]`, folders)
+
+		projects, err := cli.Execute(context.Background(), "gcloud", []string{"projects", "list", "--format=json", "--filter=parent.id=(10 20) AND (labels.env=prod OR name:Dev)"}, nil)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"projectId": "prod-project", "name": "Prod", "labels": {"env": "prod"}, "parent": {"type": "folder", "id": "20"}}]`, projects)
+
+		_, err = cli.Execute(context.Background(), "gcloud", []string{"projects", "list", "--format=json", "--filter=(labels.env=prod"}, nil)
+		assert.EqualError(t, err, "fakecli: unsupported filter (labels.env=prod: missing )")
+	})
+
+	t.Run("should list only the projects and clusters the account can see", func(t *testing.T) {
+		cli := fakecli.New(fakecli.Fixture{
+			Account:        "me@example.com",
+			Configurations: map[string]string{"work": "work@example.com"},
+			Projects: []fakecli.Project{
+				{ProjectID: "shared-project"},
+				{ProjectID: "work-project", Accounts: []string{"work@example.com"}},
+			},
+		})
+
+		projects, err := cli.Execute(context.Background(), "gcloud", []string{"projects", "list", "--format=json"}, nil)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"projectId": "shared-project"}]`, projects)
+
+		projects, err = cli.Execute(context.Background(), "gcloud", []string{"projects", "list", "--format=json", "--account=work@example.com"}, nil)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"projectId": "shared-project"}, {"projectId": "work-project"}]`, projects)
+
+		account, err := cli.Execute(context.Background(), "gcloud", []string{"config", "get-value", "account"}, []string{"CLOUDSDK_ACTIVE_CONFIG_NAME=work"})
+		assert.Nil(t, err)
+		assert.Equal(t, "work@example.com", account)
+
+		_, err = cli.Execute(context.Background(), "gcloud", []string{"container", "clusters", "list", "--project", "work-project", "--format=json"}, nil)
+		assert.EqualError(t, err, "ERROR: (gcloud.container.clusters) ResponseError: code=403, message=Project work-project not found or permission denied")
+	})
+
+	t.Run("should get the credentials of clusters that cannot be listed", func(t *testing.T) {
+		cli := fakecli.New(fakecli.Fixture{Projects: []fakecli.Project{{ProjectID: "test-project", DenyList: true, Clusters: fixture.Projects[0].Clusters}}})
+		dir, err := ioutil.TempDir("", "kube-tmuxp-fakecli")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		file := path.Join(dir, "kubeconfig")
+
+		_, err = cli.Execute(context.Background(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json"}, nil)
+		assert.EqualError(t, err, `ERROR: (gcloud.container.clusters.list) ResponseError: code=403, message=Required "container.clusters.list" permission(s) for "projects/test-project".`)
+		_, err = cli.Execute(context.Background(), "gcloud", []string{"container", "clusters", "get-credentials", "test-cluster", "--location=test-zone", "--project", "test-project"}, []string{"KUBECONFIG=" + file})
+		assert.Nil(t, err)
+
+		data, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.Contains(t, string(data), "server: https://10.0.0.1\n")
+		assert.Contains(t, string(data), "current-context: gke_test-project_test-zone_test-cluster\n")
+	})
+
+	t.Run("should fail like gcloud for unknown projects and commands", func(t *testing.T) {
+		cli := fakecli.New(fixture)
+
+		_, err := cli.Execute(context.Background(), "gcloud", []string{"container", "clusters", "list", "--project", "unknown", "--format=json"}, nil)
+		assert.EqualError(t, err, "ERROR: (gcloud.container.clusters) ResponseError: code=403, message=Project unknown not found or permission denied")
+
+		_, err = cli.Execute(context.Background(), "kubectl", []string{"get", "pods"}, nil)
+		assert.EqualError(t, err, "fakecli: unexpected command kubectl get pods")
+	})
+}
@@ -0,0 +1,143 @@
+package fakecli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// filter is a parsed gcloud filter expression supporting the subset
+// kube-tmuxp relies on: key=value and key:value terms, where value can
+// be a (value1 value2) list matching any of them, combined with AND,
+// OR, implicit AND and parentheses
+type filter func(fields map[string]string) bool
+
+func parseFilter(expression string) (filter, error) {
+	p := &filterParser{tokens: tokenize(expression)}
+	f, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("fakecli: unsupported filter %s: %v", expression, err)
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("fakecli: unsupported filter %s: unexpected %s", expression, p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+// tokenize splits the expression into parentheses, AND, OR and terms,
+// keeping the value lists of terms like key=(a b) in the terms
+func tokenize(expression string) []string {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			start := i
+			for i < len(expression) && expression[i] != ' ' && expression[i] != '(' && expression[i] != ')' {
+				i++
+			}
+			if i < len(expression) && expression[i] == '(' && i > start && strings.ContainsAny(expression[i-1:i], "=:") {
+				end := strings.IndexByte(expression[i:], ')')
+				if end < 0 {
+					end = len(expression) - i - 1
+				}
+				i += end + 1
+			}
+			tokens = append(tokens, expression[start:i])
+		}
+	}
+	return tokens
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(fields map[string]string) bool { return l(fields) || right(fields) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for next := p.peek(); next != "" && next != ")" && next != "OR"; next = p.peek() {
+		if next == "AND" {
+			p.pos++
+		}
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(fields map[string]string) bool { return l(fields) && right(fields) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) operand() (filter, error) {
+	token := p.peek()
+	p.pos++
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "(":
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return f, nil
+	default:
+		return term(token)
+	}
+}
+
+func term(token string) (filter, error) {
+	i := strings.IndexAny(token, "=:")
+	if i <= 0 {
+		return nil, fmt.Errorf("unexpected %s", token)
+	}
+	key, value := token[:i], token[i+1:]
+	values := []string{value}
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		values = strings.Fields(value[1 : len(value)-1])
+	}
+	return func(fields map[string]string) bool {
+		actual, ok := fields[key]
+		for _, v := range values {
+			if ok && (actual == strings.Trim(v, `"`) || v == "*") {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,62 @@
+// Package golden compares the files written to an in-memory
+// filesystem with golden files checked in under testdata
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// Tree renders the files and directories held by fs under the given
+// dirs, with their paths relative to root, their modes and contents
+func Tree(fs *filesystem.Memory, root string, dirs ...string) string {
+	var tree strings.Builder
+	for _, entry := range fs.Snapshot() {
+		if entry.Removed || !under(entry.Path, dirs) {
+			continue
+		}
+		name := strings.TrimPrefix(entry.Path, root+"/")
+		if entry.Mode.IsDir() {
+			_, _ = fmt.Fprintf(&tree, "== %s/ (%04o)\n", name, entry.Mode.Perm())
+			continue
+		}
+		_, _ = fmt.Fprintf(&tree, "== %s (%04o)\n%s", name, entry.Mode.Perm(), entry.Data)
+		if len(entry.Data) > 0 && entry.Data[len(entry.Data)-1] != '\n' {
+			tree.WriteString("\n")
+		}
+	}
+	return tree.String()
+}
+
+// Assert compares actual with the contents of the golden file,
+// rewriting the golden file instead when run with -update
+func Assert(t *testing.T, file, actual string) {
+	if *update {
+		if err := ioutil.WriteFile(file, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v: run the tests with -update to create it", err)
+	}
+	assert.Equal(t, string(expected), actual, "%s differs: run the tests with -update if the change is expected", file)
+}
+
+func under(file string, dirs []string) bool {
+	for _, dir := range dirs {
+		if file == dir || strings.HasPrefix(file, path.Clean(dir)+"/") {
+			return true
+		}
+	}
+	return false
+}
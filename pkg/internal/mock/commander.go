@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -33,14 +34,14 @@ func (m *Commander) EXPECT() *CommanderMockRecorder {
 }
 
 // Execute mocks base method
-func (m *Commander) Execute(cmdStr string, args, envs []string) (string, error) {
-	ret := m.ctrl.Call(m, "Execute", cmdStr, args, envs)
+func (m *Commander) Execute(ctx context.Context, cmdStr string, args, envs []string) (string, error) {
+	ret := m.ctrl.Call(m, "Execute", ctx, cmdStr, args, envs)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Execute indicates an expected call of Execute
-func (mr *CommanderMockRecorder) Execute(cmdStr, args, envs interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*Commander)(nil).Execute), cmdStr, args, envs)
+func (mr *CommanderMockRecorder) Execute(ctx, cmdStr, args, envs interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*Commander)(nil).Execute), ctx, cmdStr, args, envs)
 }
@@ -5,8 +5,11 @@
 package mock
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
+	filesystem "github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
 	io "io"
+	os "os"
 	reflect "reflect"
 )
 
@@ -95,3 +98,141 @@ func (m *FileSystem) CreateDirIfNotExist(dir string) error {
 func (mr *FileSystemMockRecorder) CreateDirIfNotExist(dir interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDirIfNotExist", reflect.TypeOf((*FileSystem)(nil).CreateDirIfNotExist), dir)
 }
+
+// Rename mocks base method
+func (m *FileSystem) Rename(oldFile, newFile string) error {
+	ret := m.ctrl.Call(m, "Rename", oldFile, newFile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rename indicates an expected call of Rename
+func (mr *FileSystemMockRecorder) Rename(oldFile, newFile interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rename", reflect.TypeOf((*FileSystem)(nil).Rename), oldFile, newFile)
+}
+
+// Stat mocks base method
+func (m *FileSystem) Stat(file string) (os.FileInfo, error) {
+	ret := m.ctrl.Call(m, "Stat", file)
+	ret0, _ := ret[0].(os.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat
+func (mr *FileSystemMockRecorder) Stat(file interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*FileSystem)(nil).Stat), file)
+}
+
+// EvalSymlinks mocks base method
+func (m *FileSystem) EvalSymlinks(file string) (string, error) {
+	ret := m.ctrl.Call(m, "EvalSymlinks", file)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EvalSymlinks indicates an expected call of EvalSymlinks
+func (mr *FileSystemMockRecorder) EvalSymlinks(file interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EvalSymlinks", reflect.TypeOf((*FileSystem)(nil).EvalSymlinks), file)
+}
+
+// Chmod mocks base method
+func (m *FileSystem) Chmod(file string, mode os.FileMode) error {
+	ret := m.ctrl.Call(m, "Chmod", file, mode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Chmod indicates an expected call of Chmod
+func (mr *FileSystemMockRecorder) Chmod(file, mode interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chmod", reflect.TypeOf((*FileSystem)(nil).Chmod), file, mode)
+}
+
+// ReadDir mocks base method
+func (m *FileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	ret := m.ctrl.Call(m, "ReadDir", dir)
+	ret0, _ := ret[0].([]os.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadDir indicates an expected call of ReadDir
+func (mr *FileSystemMockRecorder) ReadDir(dir interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDir", reflect.TypeOf((*FileSystem)(nil).ReadDir), dir)
+}
+
+// TempFile mocks base method
+func (m *FileSystem) TempFile(dir, pattern string) (io.Writer, string, error) {
+	ret := m.ctrl.Call(m, "TempFile", dir, pattern)
+	ret0, _ := ret[0].(io.Writer)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// TempFile indicates an expected call of TempFile
+func (mr *FileSystemMockRecorder) TempFile(dir, pattern interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TempFile", reflect.TypeOf((*FileSystem)(nil).TempFile), dir, pattern)
+}
+
+// TempDir mocks base method
+func (m *FileSystem) TempDir(dir, pattern string) (string, error) {
+	ret := m.ctrl.Call(m, "TempDir", dir, pattern)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TempDir indicates an expected call of TempDir
+func (mr *FileSystemMockRecorder) TempDir(dir, pattern interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TempDir", reflect.TypeOf((*FileSystem)(nil).TempDir), dir, pattern)
+}
+
+// Lock mocks base method
+func (m *FileSystem) Lock(ctx context.Context, file string, wait bool) (filesystem.Lock, error) {
+	ret := m.ctrl.Call(m, "Lock", ctx, file, wait)
+	ret0, _ := ret[0].(filesystem.Lock)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lock indicates an expected call of Lock
+func (mr *FileSystemMockRecorder) Lock(ctx, file, wait interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*FileSystem)(nil).Lock), ctx, file, wait)
+}
+
+// MockLock is a mock of Lock interface
+type MockLock struct {
+	ctrl     *gomock.Controller
+	recorder *MockLockMockRecorder
+}
+
+// MockLockMockRecorder is the mock recorder for MockLock
+type MockLockMockRecorder struct {
+	mock *MockLock
+}
+
+// NewMockLock creates a new mock instance
+func NewMockLock(ctrl *gomock.Controller) *MockLock {
+	mock := &MockLock{ctrl: ctrl}
+	mock.recorder = &MockLockMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLock) EXPECT() *MockLockMockRecorder {
+	return m.recorder
+}
+
+// Release mocks base method
+func (m *MockLock) Release() error {
+	ret := m.ctrl.Call(m, "Release")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release
+func (mr *MockLockMockRecorder) Release() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockLock)(nil).Release))
+}
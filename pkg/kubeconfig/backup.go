@@ -0,0 +1,124 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+)
+
+const (
+	backupTimeLayout = "20060102T150405.000000000Z"
+	maxBackups       = 5
+)
+
+// BackupsDir returns the directory in which previous
+// versions of the kube configs are stored
+func (k *KubeConfig) BackupsDir() string {
+	return path.Join(k.kubeCfgsDir, ".backups")
+}
+
+// Replace moves newFile in place of kubeCfgFile and makes it readable
+// only by the owner. The existing kubeCfgFile, if any, is copied to a
+// timestamped backup first, so that kubeCfgFile is replaced atomically
+// and stays in place if anything fails.
+func (k *KubeConfig) Replace(newFile, kubeCfgFile string) error {
+	if err := k.filesystem.Chmod(newFile, 0600); err != nil {
+		return err
+	}
+	if _, err := k.filesystem.Stat(kubeCfgFile); err == nil {
+		if err := k.backup(kubeCfgFile); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return k.filesystem.Rename(newFile, kubeCfgFile)
+}
+
+func (k *KubeConfig) backup(kubeCfgFile string) error {
+	if err := filesystem.CreatePrivateDir(k.filesystem, k.BackupsDir()); err != nil {
+		return err
+	}
+
+	context := path.Base(kubeCfgFile)
+	backupFile := path.Join(k.BackupsDir(), fmt.Sprintf("%s.%s", context, time.Now().UTC().Format(backupTimeLayout)))
+	reader, err := k.filesystem.Open(kubeCfgFile)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(reader)
+	if closer, ok := reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := filesystem.WriteFile(k.filesystem, backupFile, data); err != nil {
+		return err
+	}
+
+	backups, err := k.Backups(context)
+	if err != nil {
+		return err
+	}
+	for len(backups) > maxBackups {
+		if err := k.filesystem.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Backups returns the backups of the kube config of
+// the given context from the oldest to the latest
+func (k *KubeConfig) Backups(context string) ([]string, error) {
+	infos, err := k.filesystem.ReadDir(k.BackupsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	prefix := context + "."
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeLayout, strings.TrimPrefix(name, prefix)); err != nil {
+			continue
+		}
+		backups = append(backups, path.Join(k.BackupsDir(), name))
+	}
+	return backups, nil
+}
+
+// Restore replaces the kube config of the given context with its
+// latest backup and returns the restored backup. The replaced kube
+// config becomes the latest backup so a restore can be undone by
+// restoring again.
+func (k *KubeConfig) Restore(context string) (string, error) {
+	backups, err := k.Backups(context)
+	if err != nil {
+		return "", err
+	}
+	if len(backups) == 0 {
+		return "", fmt.Errorf("no backups found for context %s", context)
+	}
+
+	latest := backups[len(backups)-1]
+	if err := k.Replace(latest, path.Join(k.kubeCfgsDir, context)); err != nil {
+		return "", err
+	}
+	return latest, nil
+}
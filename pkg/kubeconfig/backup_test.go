@@ -0,0 +1,164 @@
+package kubeconfig_test
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+)
+
+type fileInfo string
+
+func (f fileInfo) Name() string       { return string(f) }
+func (f fileInfo) Size() int64        { return 0 }
+func (f fileInfo) Mode() os.FileMode  { return 0600 }
+func (f fileInfo) ModTime() time.Time { return time.Time{} }
+func (f fileInfo) IsDir() bool        { return false }
+func (f fileInfo) Sys() interface{}   { return nil }
+
+func fileInfos(names ...string) []os.FileInfo {
+	var infos []os.FileInfo
+	for _, name := range names {
+		infos = append(infos, fileInfo(name))
+	}
+	return infos
+}
+
+func TestReplace(t *testing.T) {
+	t.Run("should move the new file in place if there is no existing kubeconfig", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Chmod("/tmp/test-ctx", os.FileMode(0600)).Return(nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/test-ctx").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Rename("/tmp/test-ctx", "/Users/test/.kube/configs/test-ctx").Return(nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		err := kubeCfg.Replace("/tmp/test-ctx", "/Users/test/.kube/configs/test-ctx")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should keep the existing kubeconfig as a backup and prune old backups", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Chmod("/tmp/test-ctx", os.FileMode(0600)).Return(nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/test-ctx").Return(fileInfo("test-ctx"), nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/.backups").Return(fileInfo(".backups"), nil)
+		mockFS.EXPECT().Chmod("/Users/test/.kube/configs/.backups", os.FileMode(0700)).Return(nil)
+		mockFS.EXPECT().Open("/Users/test/.kube/configs/test-ctx").Return(strings.NewReader("old-kubeconfig"), nil)
+		backup := &bytes.Buffer{}
+		mockFS.EXPECT().TempFile("/Users/test/.kube/configs/.backups", gomock.Any()).Return(backup, "/Users/test/.kube/configs/.backups/.test-ctx.tmp-1", nil)
+		var backupFile string
+		mockFS.EXPECT().Rename("/Users/test/.kube/configs/.backups/.test-ctx.tmp-1", gomock.Any()).Do(func(_, newFile string) {
+			backupFile = newFile
+		}).Return(nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(fileInfos(
+			"other-ctx.20200101T000000.000000000Z",
+			"test-ctx.20200101T000000.000000000Z",
+			"test-ctx.20200102T000000.000000000Z",
+			"test-ctx.20200103T000000.000000000Z",
+			"test-ctx.20200104T000000.000000000Z",
+			"test-ctx.20200105T000000.000000000Z",
+			"test-ctx.20200106T000000.000000000Z",
+		), nil)
+		mockFS.EXPECT().Remove("/Users/test/.kube/configs/.backups/test-ctx.20200101T000000.000000000Z").Return(nil)
+		mockFS.EXPECT().Rename("/tmp/test-ctx", "/Users/test/.kube/configs/test-ctx").Return(nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		err := kubeCfg.Replace("/tmp/test-ctx", "/Users/test/.kube/configs/test-ctx")
+
+		assert.Nil(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^/Users/test/\.kube/configs/\.backups/test-ctx\.\d{8}T\d{6}\.\d{9}Z$`), backupFile)
+		assert.Equal(t, "old-kubeconfig", backup.String())
+	})
+}
+
+func TestBackups(t *testing.T) {
+	t.Run("should return the backups of the context from the oldest to the latest", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(fileInfos(
+			"test-ctx.20200101T000000.000000000Z",
+			"test-ctx.20200102T000000.000000000Z",
+			"test-ctx.not-a-backup",
+			"test-ctx-2.20200101T000000.000000000Z",
+		), nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		backups, err := kubeCfg.Backups("test-ctx")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			"/Users/test/.kube/configs/.backups/test-ctx.20200101T000000.000000000Z",
+			"/Users/test/.kube/configs/.backups/test-ctx.20200102T000000.000000000Z",
+		}, backups)
+	})
+
+	t.Run("should return no backups if the backups dir does not exist", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(nil, &os.PathError{Op: "open", Err: os.ErrNotExist})
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		backups, err := kubeCfg.Backups("test-ctx")
+
+		assert.Nil(t, err)
+		assert.Empty(t, backups)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Run("should replace the kubeconfig with its latest backup", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(fileInfos(
+			"test-ctx.20200101T000000.000000000Z",
+			"test-ctx.20200102T000000.000000000Z",
+		), nil)
+		mockFS.EXPECT().Chmod("/Users/test/.kube/configs/.backups/test-ctx.20200102T000000.000000000Z", os.FileMode(0600)).Return(nil)
+		mockFS.EXPECT().Stat("/Users/test/.kube/configs/test-ctx").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().Rename("/Users/test/.kube/configs/.backups/test-ctx.20200102T000000.000000000Z", "/Users/test/.kube/configs/test-ctx").Return(nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		backup, err := kubeCfg.Restore("test-ctx")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/Users/test/.kube/configs/.backups/test-ctx.20200102T000000.000000000Z", backup)
+	})
+
+	t.Run("should return error if there are no backups", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().ReadDir("/Users/test/.kube/configs/.backups").Return(nil, nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		_, err := kubeCfg.Restore("test-ctx")
+
+		assert.EqualError(t, err, "no backups found for context test-ctx")
+	})
+}
@@ -0,0 +1,253 @@
+package kubeconfig
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// File represents the contents of a kubeconfig file
+type File struct {
+	APIVersion     string         `yaml:"apiVersion"`
+	Kind           string         `yaml:"kind"`
+	CurrentContext string         `yaml:"current-context"`
+	Clusters       []NamedCluster `yaml:"clusters"`
+	Contexts       []NamedContext `yaml:"contexts"`
+	Users          []NamedUser    `yaml:"users"`
+}
+
+// NamedCluster represents a cluster entry in a kubeconfig file
+type NamedCluster struct {
+	Name    string  `yaml:"name"`
+	Cluster Cluster `yaml:"cluster"`
+}
+
+// Cluster represents the connection details of a cluster
+type Cluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify,omitempty"`
+	ProxyURL                 string `yaml:"proxy-url,omitempty"`
+}
+
+// NamedContext represents a context entry in a kubeconfig file
+type NamedContext struct {
+	Name    string  `yaml:"name"`
+	Context Context `yaml:"context"`
+}
+
+// Context represents a pair of cluster and user
+type Context struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// NamedUser represents a user entry in a kubeconfig file
+type NamedUser struct {
+	Name string `yaml:"name"`
+	User User   `yaml:"user"`
+}
+
+// User represents the credentials used to talk to a cluster
+type User struct {
+	ClientCertificateData string        `yaml:"client-certificate-data,omitempty"`
+	ClientKeyData         string        `yaml:"client-key-data,omitempty"`
+	Token                 string        `yaml:"token,omitempty"`
+	AuthProvider          *AuthProvider `yaml:"auth-provider,omitempty"`
+	Exec                  *Exec         `yaml:"exec,omitempty"`
+}
+
+// AuthProvider represents a legacy auth provider plugin
+type AuthProvider struct {
+	Name   string            `yaml:"name"`
+	Config map[string]string `yaml:"config,omitempty"`
+}
+
+// Exec represents an exec credential plugin
+type Exec struct {
+	APIVersion         string    `yaml:"apiVersion"`
+	Command            string    `yaml:"command"`
+	Args               []string  `yaml:"args,omitempty"`
+	Env                []ExecEnv `yaml:"env,omitempty"`
+	InstallHint        string    `yaml:"installHint,omitempty"`
+	ProvideClusterInfo bool      `yaml:"provideClusterInfo"`
+	InteractiveMode    string    `yaml:"interactiveMode,omitempty"`
+}
+
+// ExecEnv represents an env variable passed to an exec credential plugin
+type ExecEnv struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Current returns the cluster and user of the current context.
+// The first context is used if current context is not set.
+func (f File) Current() (Cluster, User, error) {
+	if len(f.Contexts) == 0 {
+		return Cluster{}, User{}, fmt.Errorf("no contexts found")
+	}
+
+	ctx := f.Contexts[0]
+	for _, c := range f.Contexts {
+		if c.Name == f.CurrentContext {
+			ctx = c
+		}
+	}
+
+	var cluster *Cluster
+	for i := range f.Clusters {
+		if f.Clusters[i].Name == ctx.Context.Cluster {
+			cluster = &f.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil {
+		return Cluster{}, User{}, fmt.Errorf("cluster %s of context %s not found", ctx.Context.Cluster, ctx.Name)
+	}
+
+	for _, u := range f.Users {
+		if u.Name == ctx.Context.User {
+			return *cluster, u.User, nil
+		}
+	}
+	return Cluster{}, User{}, fmt.Errorf("user %s of context %s not found", ctx.Context.User, ctx.Name)
+}
+
+// Credential represents a credential found in a kubeconfig user
+type Credential struct {
+	Kind string
+	// Expiry is zero when the credential does not expire
+	// or its expiry cannot be determined
+	Expiry time.Time
+}
+
+// Credentials returns the credentials of the user along with their expiry
+func (u User) Credentials() ([]Credential, error) {
+	var creds []Credential
+	if u.ClientCertificateData != "" {
+		expiry, err := certificateExpiry(u.ClientCertificateData)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, Credential{Kind: "client-certificate", Expiry: expiry})
+	}
+	if u.Token != "" {
+		creds = append(creds, Credential{Kind: "token", Expiry: tokenExpiry(u.Token)})
+	}
+	if u.AuthProvider != nil {
+		cred := Credential{Kind: fmt.Sprintf("auth-provider:%s", u.AuthProvider.Name)}
+		if expiry, err := time.Parse(time.RFC3339, u.AuthProvider.Config["expiry"]); err == nil {
+			cred.Expiry = expiry
+		} else if idToken := u.AuthProvider.Config["id-token"]; idToken != "" {
+			cred.Expiry = tokenExpiry(idToken)
+		}
+		creds = append(creds, cred)
+	}
+	if u.Exec != nil {
+		creds = append(creds, Credential{Kind: fmt.Sprintf("exec:%s", u.Exec.Command)})
+	}
+	return creds, nil
+}
+
+// BearerToken returns the static token of the user if there is one
+func (u User) BearerToken() string {
+	if u.Token != "" {
+		return u.Token
+	}
+	if u.AuthProvider != nil {
+		return u.AuthProvider.Config["access-token"]
+	}
+	return ""
+}
+
+func certificateExpiry(data string) (time.Time, error) {
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error decoding client certificate: %v", err)
+	}
+	block, _ := pem.Decode(decoded)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("error decoding client certificate: no PEM data found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing client certificate: %v", err)
+	}
+	return cert.NotAfter, nil
+}
+
+// tokenExpiry returns the exp claim of a JWT. Tokens that
+// are not JWTs are treated as never expiring.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// Read reads the given kubeconfig file
+func (k *KubeConfig) Read(kubeCfgFile string) (File, error) {
+	reader, err := k.filesystem.Open(kubeCfgFile)
+	if err != nil {
+		return File{}, err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return File{}, err
+	}
+
+	file, err := Parse(data)
+	if err != nil {
+		return File{}, fmt.Errorf("error parsing kubeconfig %s: %v", kubeCfgFile, err)
+	}
+	return file, nil
+}
+
+// Parse parses the contents of a kubeconfig file
+func Parse(data []byte) (File, error) {
+	var file File
+	err := yaml.Unmarshal(data, &file)
+	return file, err
+}
+
+// Write writes the given contents to the kubeconfig file
+func (k *KubeConfig) Write(kubeCfgFile string, file File) error {
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	writer, err := k.filesystem.Create(kubeCfgFile)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	if closer, ok := writer.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
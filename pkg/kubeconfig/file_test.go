@@ -0,0 +1,197 @@
+package kubeconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+)
+
+func certificateData(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notAfter.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func jwt(exp int64) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"test","exp":%d}`, exp)))
+	return fmt.Sprintf("eyJhbGciOiJub25lIn0.%s.signature", payload)
+}
+
+func TestRead(t *testing.T) {
+	t.Run("should read the given kubeconfig file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Open("/Users/test/.kube/configs/test-ctx").Return(strings.NewReader(`
+apiVersion: v1
+kind: Config
+current-context: test-ctx
+clusters:
+- name: test-cluster
+  cluster:
+    server: https://10.0.0.1
+    certificate-authority-data: Y2EtZGF0YQ==
+contexts:
+- name: test-ctx
+  context:
+    cluster: test-cluster
+    user: test-user
+users:
+- name: test-user
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: gke-gcloud-auth-plugin
+      provideClusterInfo: true
+`), nil)
+
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+		file, err := kubeCfg.Read("/Users/test/.kube/configs/test-ctx")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "test-ctx", file.CurrentContext)
+		assert.Equal(t, []kubeconfig.NamedCluster{{Name: "test-cluster", Cluster: kubeconfig.Cluster{Server: "https://10.0.0.1", CertificateAuthorityData: "Y2EtZGF0YQ=="}}}, file.Clusters)
+		assert.Equal(t, "gke-gcloud-auth-plugin", file.Users[0].User.Exec.Command)
+	})
+
+	t.Run("should return error if kubeconfig cannot be parsed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Open("/Users/test/.kube/configs/test-ctx").Return(strings.NewReader("invalid yaml"), nil)
+
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+		_, err := kubeCfg.Read("/Users/test/.kube/configs/test-ctx")
+
+		assert.EqualError(t, err, "error parsing kubeconfig /Users/test/.kube/configs/test-ctx: yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `invalid...` into kubeconfig.File")
+	})
+}
+
+func TestCurrent(t *testing.T) {
+	file := kubeconfig.File{
+		CurrentContext: "second",
+		Clusters: []kubeconfig.NamedCluster{
+			{Name: "one", Cluster: kubeconfig.Cluster{Server: "https://one"}},
+			{Name: "two", Cluster: kubeconfig.Cluster{Server: "https://two"}},
+		},
+		Contexts: []kubeconfig.NamedContext{
+			{Name: "first", Context: kubeconfig.Context{Cluster: "one", User: "one"}},
+			{Name: "second", Context: kubeconfig.Context{Cluster: "two", User: "two"}},
+		},
+		Users: []kubeconfig.NamedUser{
+			{Name: "one", User: kubeconfig.User{Token: "one"}},
+			{Name: "two", User: kubeconfig.User{Token: "two"}},
+		},
+	}
+
+	t.Run("should return cluster and user of current context", func(t *testing.T) {
+		cluster, user, err := file.Current()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "https://two", cluster.Server)
+		assert.Equal(t, "two", user.Token)
+	})
+
+	t.Run("should fallback to first context if current context is not set", func(t *testing.T) {
+		f := file
+		f.CurrentContext = ""
+
+		cluster, user, err := f.Current()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "https://one", cluster.Server)
+		assert.Equal(t, "one", user.Token)
+	})
+
+	t.Run("should return error if there are no contexts", func(t *testing.T) {
+		_, _, err := kubeconfig.File{}.Current()
+
+		assert.EqualError(t, err, "no contexts found")
+	})
+
+	t.Run("should return error if user of the context is missing", func(t *testing.T) {
+		f := file
+		f.Users = nil
+
+		_, _, err := f.Current()
+
+		assert.EqualError(t, err, "user two of context second not found")
+	})
+}
+
+func TestCredentials(t *testing.T) {
+	t.Run("should return expiry of client certificate", func(t *testing.T) {
+		notAfter := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+		user := kubeconfig.User{ClientCertificateData: certificateData(t, notAfter)}
+
+		creds, err := user.Credentials()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []kubeconfig.Credential{{Kind: "client-certificate", Expiry: notAfter}}, creds)
+	})
+
+	t.Run("should return error if client certificate is invalid", func(t *testing.T) {
+		user := kubeconfig.User{ClientCertificateData: base64.StdEncoding.EncodeToString([]byte("invalid"))}
+
+		_, err := user.Credentials()
+
+		assert.EqualError(t, err, "error decoding client certificate: no PEM data found")
+	})
+
+	t.Run("should return expiry of JWT tokens and zero expiry for opaque tokens", func(t *testing.T) {
+		jwtCreds, _ := kubeconfig.User{Token: jwt(1700000000)}.Credentials()
+		opaqueCreds, _ := kubeconfig.User{Token: "opaque-token"}.Credentials()
+
+		assert.Equal(t, []kubeconfig.Credential{{Kind: "token", Expiry: time.Unix(1700000000, 0)}}, jwtCreds)
+		assert.Equal(t, []kubeconfig.Credential{{Kind: "token"}}, opaqueCreds)
+	})
+
+	t.Run("should return expiry of auth provider tokens", func(t *testing.T) {
+		user := kubeconfig.User{AuthProvider: &kubeconfig.AuthProvider{
+			Name:   "gcp",
+			Config: map[string]string{"access-token": "token", "expiry": "2019-10-10T10:10:10Z"},
+		}}
+
+		creds, err := user.Credentials()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []kubeconfig.Credential{{Kind: "auth-provider:gcp", Expiry: time.Date(2019, 10, 10, 10, 10, 10, 0, time.UTC)}}, creds)
+		assert.Equal(t, "token", user.BearerToken())
+	})
+
+	t.Run("should return exec plugins without expiry", func(t *testing.T) {
+		user := kubeconfig.User{Exec: &kubeconfig.Exec{Command: "gke-gcloud-auth-plugin"}}
+
+		creds, err := user.Credentials()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []kubeconfig.Credential{{Kind: "exec:gke-gcloud-auth-plugin"}}, creds)
+		assert.Equal(t, "", user.BearerToken())
+	})
+}
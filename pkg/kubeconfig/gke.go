@@ -0,0 +1,48 @@
+package kubeconfig
+
+// gkeAuthPluginInstallHint is shown by kubectl when gke-gcloud-auth-plugin is missing
+const gkeAuthPluginInstallHint = "Install gke-gcloud-auth-plugin for use with kubectl by following https://cloud.google.com/blog/products/containers-kubernetes/kubectl-auth-changes-in-gke"
+
+// GKECluster represents what a kubeconfig needs to connect to a GKE cluster
+type GKECluster struct {
+	Endpoint string
+	// CACertificate is the base64 encoded certificate of the cluster CA,
+	// empty for endpoints with publicly trusted certificates
+	CACertificate string
+	// ProxyURL is the proxy the cluster is reached through, if any
+	ProxyURL string
+}
+
+// NewGKEFile returns a kubeconfig with the given context for the GKE
+// cluster, like the one written by gcloud container clusters get-credentials.
+// Its cluster and user entries are given name and the user gets its
+// credentials from gke-gcloud-auth-plugin, run with the given envs.
+func NewGKEFile(name string, context string, cluster GKECluster, env ...ExecEnv) File {
+	return File{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		CurrentContext: context,
+		Clusters: []NamedCluster{{
+			Name: name,
+			Cluster: Cluster{
+				Server:                   "https://" + cluster.Endpoint,
+				CertificateAuthorityData: cluster.CACertificate,
+				ProxyURL:                 cluster.ProxyURL,
+			},
+		}},
+		Contexts: []NamedContext{{
+			Name:    context,
+			Context: Context{Cluster: name, User: name},
+		}},
+		Users: []NamedUser{{
+			Name: name,
+			User: User{Exec: &Exec{
+				APIVersion:         "client.authentication.k8s.io/v1beta1",
+				Command:            "gke-gcloud-auth-plugin",
+				Env:                env,
+				InstallHint:        gkeAuthPluginInstallHint,
+				ProvideClusterInfo: true,
+			}},
+		}},
+	}
+}
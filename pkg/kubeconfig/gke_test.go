@@ -0,0 +1,54 @@
+package kubeconfig_test
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+)
+
+func TestNewGKEFile(t *testing.T) {
+	t.Run("should write a kubeconfig using gke-gcloud-auth-plugin for the cluster", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.CreateDirIfNotExist("/Users/test/.kube/configs"))
+		kubeCfg, _ := kubeconfig.New(fs, mock.NewCommander(ctrl))
+
+		file := kubeconfig.NewGKEFile("gke_test-project_us-central1_test-cluster", "test-ctx", kubeconfig.GKECluster{Endpoint: "10.0.0.1", CACertificate: "Y2EtZGF0YQ=="})
+		assert.Nil(t, kubeCfg.Write("/Users/test/.kube/configs/test-ctx", file))
+		written, err := kubeCfg.Read("/Users/test/.kube/configs/test-ctx")
+
+		assert.Nil(t, err)
+		assert.Equal(t, file, written)
+		assert.Equal(t, "test-ctx", written.CurrentContext)
+		assert.Equal(t, []kubeconfig.NamedContext{{Name: "test-ctx", Context: kubeconfig.Context{Cluster: "gke_test-project_us-central1_test-cluster", User: "gke_test-project_us-central1_test-cluster"}}}, written.Contexts)
+		cluster, user, err := written.Current()
+		assert.Nil(t, err)
+		assert.Equal(t, kubeconfig.Cluster{Server: "https://10.0.0.1", CertificateAuthorityData: "Y2EtZGF0YQ=="}, cluster)
+		assert.Equal(t, "gke-gcloud-auth-plugin", user.Exec.Command)
+		assert.True(t, user.Exec.ProvideClusterInfo)
+	})
+
+	t.Run("should reach the cluster through its proxy without a CA for publicly trusted endpoints", func(t *testing.T) {
+		file := kubeconfig.NewGKEFile("gke_test-project_us-central1_test-cluster", "test-ctx", kubeconfig.GKECluster{Endpoint: "gke-1234.us-central1.gke.goog", ProxyURL: "socks5://localhost:1080"})
+
+		cluster, _, err := file.Current()
+		assert.Nil(t, err)
+		assert.Equal(t, kubeconfig.Cluster{Server: "https://gke-1234.us-central1.gke.goog", ProxyURL: "socks5://localhost:1080"}, cluster)
+	})
+
+	t.Run("should run gke-gcloud-auth-plugin with the given envs", func(t *testing.T) {
+		env := []kubeconfig.ExecEnv{{Name: "CLOUDSDK_CORE_ACCOUNT", Value: "test@example.com"}}
+
+		file := kubeconfig.NewGKEFile("gke_test-project_us-central1_test-cluster", "test-ctx", kubeconfig.GKECluster{Endpoint: "10.0.0.1"}, env...)
+
+		_, user, err := file.Current()
+		assert.Nil(t, err)
+		assert.Equal(t, env, user.Exec.Env)
+	})
+}
@@ -1,7 +1,7 @@
 package kubeconfig
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"path"
 
@@ -14,6 +14,7 @@ type KubeConfig struct {
 	filesystem  filesystem.FileSystem
 	commander   commander.Commander
 	kubeCfgsDir string
+	defaultDir  string
 }
 
 // Delete deletes the given kubeconfig file
@@ -25,70 +26,68 @@ func (k *KubeConfig) Delete(kubeCfgFile string) error {
 	return nil
 }
 
-// AddRegionalCluster imports Kubernetes context for
-// a regional Kubernetes cluster
-func (k *KubeConfig) AddRegionalCluster(project string, cluster string, region string, kubeCfgFile string) error {
-	args := []string{
-		"beta",
-		"container",
-		"clusters",
-		"get-credentials",
-		cluster,
-		fmt.Sprintf("--region=%s", region),
-		fmt.Sprintf("--project=%s", project),
-	}
-	envs := []string{
-		fmt.Sprintf("KUBECONFIG=%s", kubeCfgFile),
-	}
-	if _, err := k.commander.Execute("gcloud", args, envs); err != nil {
-		return err
-	}
+// KubeCfgsDir returns the directory in which kube configs are stored
+func (k *KubeConfig) KubeCfgsDir() string {
+	return k.kubeCfgsDir
+}
 
-	return nil
+// Commander returns the Commander used to fetch kubeconfigs
+func (k KubeConfig) Commander() commander.Commander {
+	return k.commander
 }
 
-// AddZonalCluster imports Kubernetes context for
-// a zonal Kubernetes cluster
-func (k *KubeConfig) AddZonalCluster(project string, cluster string, zone string, kubeCfgFile string) error {
-	args := []string{
-		"container",
-		"clusters",
-		"get-credentials",
-		cluster,
-		fmt.Sprintf("--zone=%s", zone),
-		fmt.Sprintf("--project=%s", project),
-	}
-	envs := []string{
-		fmt.Sprintf("KUBECONFIG=%s", kubeCfgFile),
-	}
-	if _, err := k.commander.Execute("gcloud", args, envs); err != nil {
-		return err
-	}
+// WithCommander returns a copy of the KubeConfig that
+// fetches kubeconfigs with the given Commander
+func (k KubeConfig) WithCommander(cmdr commander.Commander) KubeConfig {
+	k.commander = cmdr
+	return k
+}
 
-	return nil
+// WithDir returns a copy of the KubeConfig that
+// stores kube configs in the given directory
+func (k KubeConfig) WithDir(dir string) KubeConfig {
+	k.kubeCfgsDir = dir
+	return k
 }
 
-// RenameContext renames a Kubernetes context
-func (k *KubeConfig) RenameContext(oldCtx string, newCtx string, kubeCfgFile string) error {
-	args := []string{
-		"config",
-		"rename-context",
-		oldCtx,
-		newCtx,
-	}
-	envs := []string{
-		fmt.Sprintf("KUBECONFIG=%s", kubeCfgFile),
-	}
-	if _, err := k.commander.Execute("kubectl", args, envs); err != nil {
-		return err
+// LockFile returns the file that is locked while the
+// kube configs are being modified
+func (k *KubeConfig) LockFile() string {
+	return path.Join(k.kubeCfgsDir, ".kube-tmuxp.lock")
+}
+
+// CreateDir creates the directory of the kube configs accessible only
+// by the owner. The default directory is restricted to the owner if it
+// exists already, while a directory given with WithDir is left as it is.
+func (k *KubeConfig) CreateDir() error {
+	if k.kubeCfgsDir == k.defaultDir {
+		return filesystem.CreatePrivateDir(k.filesystem, k.kubeCfgsDir)
 	}
+	return filesystem.CreatePrivateDirIfNotExist(k.filesystem, k.kubeCfgsDir)
+}
 
-	return nil
+// Lock takes the lock on the kube configs, creating their directory if
+// needed, and waits for other kube-tmuxp commands to release it when
+// wait is true, until ctx is done
+func (k *KubeConfig) Lock(ctx context.Context, wait bool) (filesystem.Lock, error) {
+	if err := k.CreateDir(); err != nil {
+		return nil, err
+	}
+	return k.filesystem.Lock(ctx, k.LockFile(), wait)
 }
 
-// KubeCfgsDir returns the directory in which kube configs are stored
-func (k *KubeConfig) KubeCfgsDir() string {
-	return k.kubeCfgsDir
+// Locked runs fn while holding the lock on the kube configs. Dry runs
+// do not change anything and therefore run fn without taking the lock.
+func (k *KubeConfig) Locked(ctx context.Context, wait, dryRun bool, fn func() error) error {
+	if dryRun {
+		return fn()
+	}
+	l, err := k.Lock(ctx, wait)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return fn()
 }
 
 // New returns a new KubeConfig
@@ -103,5 +102,6 @@ func New(fs filesystem.FileSystem, cmdr commander.Commander) (KubeConfig, error)
 		filesystem:  fs,
 		commander:   cmdr,
 		kubeCfgsDir: kubeConfigsDir,
+		defaultDir:  kubeConfigsDir,
 	}, nil
 }
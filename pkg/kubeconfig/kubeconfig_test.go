@@ -1,12 +1,14 @@
 package kubeconfig_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
 )
@@ -86,36 +88,8 @@ func TestDelete(t *testing.T) {
 	})
 }
 
-func TestAddRegionalCluster(t *testing.T) {
-	t.Run("should invoke command for adding regional cluster", func(*testing.T) {
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-
-		mockFS := mock.NewFileSystem(ctrl)
-		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-
-		mockCmdr := mock.NewCommander(ctrl)
-		args := []string{
-			"beta",
-			"container",
-			"clusters",
-			"get-credentials",
-			"test-cluster",
-			"--region=test-region",
-			"--project=test-project",
-		}
-		envs := []string{
-			"KUBECONFIG=/Users/test/.kube/configs/test-context",
-		}
-		mockCmdr.EXPECT().Execute("gcloud", args, envs).Return("Context added successfully", nil)
-
-		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		err := kubeCfg.AddRegionalCluster("test-project", "test-cluster", "test-region", "/Users/test/.kube/configs/test-context")
-
-		assert.Nil(t, err)
-	})
-
-	t.Run("should return error if command failed to execute", func(*testing.T) {
+func TestKubeCfgsDir(t *testing.T) {
+	t.Run("should return the directory in which kube configs are stored", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
@@ -123,148 +97,76 @@ func TestAddRegionalCluster(t *testing.T) {
 		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
 
 		mockCmdr := mock.NewCommander(ctrl)
-		args := []string{
-			"beta",
-			"container",
-			"clusters",
-			"get-credentials",
-			"test-cluster",
-			"--region=test-region",
-			"--project=test-project",
-		}
-		envs := []string{
-			"KUBECONFIG=/Users/test/.kube/configs/test-context",
-		}
-		mockCmdr.EXPECT().Execute("gcloud", args, envs).Return("", fmt.Errorf("some error"))
 
 		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		err := kubeCfg.AddRegionalCluster("test-project", "test-cluster", "test-region", "/Users/test/.kube/configs/test-context")
+		dir := kubeCfg.KubeCfgsDir()
 
-		assert.EqualError(t, err, "some error")
+		assert.Equal(t, "/Users/test/.kube/configs", dir)
 	})
 }
 
-func TestAddZonalCluster(t *testing.T) {
-	t.Run("should invoke command for adding zonal cluster", func(*testing.T) {
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
+func TestLock(t *testing.T) {
+	t.Run("should create the directory of the kube configs and lock them", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		kubeCfg, _ := kubeconfig.New(fs, nil)
 
-		mockFS := mock.NewFileSystem(ctrl)
-		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-
-		mockCmdr := mock.NewCommander(ctrl)
-		args := []string{
-			"container",
-			"clusters",
-			"get-credentials",
-			"test-cluster",
-			"--zone=test-zone",
-			"--project=test-project",
-		}
-		envs := []string{
-			"KUBECONFIG=/Users/test/.kube/configs/test-context",
-		}
-		mockCmdr.EXPECT().Execute("gcloud", args, envs).Return("Context added successfully", nil)
-
-		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		err := kubeCfg.AddZonalCluster("test-project", "test-cluster", "test-zone", "/Users/test/.kube/configs/test-context")
+		l, err := kubeCfg.Lock(context.Background(), false)
 
 		assert.Nil(t, err)
-	})
-
-	t.Run("should return error if command failed to execute", func(*testing.T) {
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-
-		mockFS := mock.NewFileSystem(ctrl)
-		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-
-		mockCmdr := mock.NewCommander(ctrl)
-		args := []string{
-			"container",
-			"clusters",
-			"get-credentials",
-			"test-cluster",
-			"--zone=test-zone",
-			"--project=test-project",
-		}
-		envs := []string{
-			"KUBECONFIG=/Users/test/.kube/configs/test-context",
-		}
-		mockCmdr.EXPECT().Execute("gcloud", args, envs).Return("", fmt.Errorf("some error"))
-
-		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		err := kubeCfg.AddZonalCluster("test-project", "test-cluster", "test-zone", "/Users/test/.kube/configs/test-context")
-
-		assert.EqualError(t, err, "some error")
+		info, err := fs.Stat("/Users/test/.kube/configs")
+		assert.Nil(t, err)
+		assert.True(t, info.IsDir())
+		_, err = kubeCfg.Lock(context.Background(), false)
+		assert.NotNil(t, err)
+		assert.Nil(t, l.Release())
 	})
 }
 
-func TestRenameContext(t *testing.T) {
-	t.Run("should rename a context", func(t *testing.T) {
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-
-		mockFS := mock.NewFileSystem(ctrl)
-		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-
-		mockCmdr := mock.NewCommander(ctrl)
-		args := []string{
-			"config",
-			"rename-context",
-			"old-context-name",
-			"new-context-name",
-		}
-		envs := []string{
-			"KUBECONFIG=/Users/test/.kube/configs/new-context-name",
-		}
-		mockCmdr.EXPECT().Execute("kubectl", args, envs).Return("Context renamed", nil)
+func TestLocked(t *testing.T) {
+	t.Run("should run fn while holding the lock on the kube configs", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		kubeCfg, _ := kubeconfig.New(fs, nil)
 
-		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		err := kubeCfg.RenameContext("old-context-name", "new-context-name", "/Users/test/.kube/configs/new-context-name")
+		err := kubeCfg.Locked(context.Background(), false, false, func() error {
+			_, err := kubeCfg.Lock(context.Background(), false)
+			assert.NotNil(t, err)
+			return nil
+		})
 
 		assert.Nil(t, err)
+		l, err := kubeCfg.Lock(context.Background(), false)
+		assert.Nil(t, err)
+		assert.Nil(t, l.Release())
 	})
 
-	t.Run("should return error if renaming context fails", func(t *testing.T) {
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-
-		mockFS := mock.NewFileSystem(ctrl)
-		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-
-		mockCmdr := mock.NewCommander(ctrl)
-		args := []string{
-			"config",
-			"rename-context",
-			"old-context-name",
-			"new-context-name",
-		}
-		envs := []string{
-			"KUBECONFIG=/Users/test/.kube/configs/new-context-name",
-		}
-		mockCmdr.EXPECT().Execute("kubectl", args, envs).Return("", fmt.Errorf("some error"))
+	t.Run("should run fn without taking the lock on dry runs", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		kubeCfg, _ := kubeconfig.New(fs, nil)
 
-		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		err := kubeCfg.RenameContext("old-context-name", "new-context-name", "/Users/test/.kube/configs/new-context-name")
+		err := kubeCfg.Locked(context.Background(), false, true, func() error {
+			return fmt.Errorf("failed")
+		})
 
-		assert.EqualError(t, err, "some error")
+		assert.EqualError(t, err, "failed")
+		_, err = fs.Stat("/Users/test/.kube/configs")
+		assert.True(t, os.IsNotExist(err))
 	})
 }
 
-func TestKubeCfgsDir(t *testing.T) {
-	t.Run("should return the directory in which kube configs are stored", func(t *testing.T) {
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-
-		mockFS := mock.NewFileSystem(ctrl)
-		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-
-		mockCmdr := mock.NewCommander(ctrl)
-
-		kubeCfg, _ := kubeconfig.New(mockFS, mockCmdr)
-		dir := kubeCfg.KubeCfgsDir()
-
-		assert.Equal(t, "/Users/test/.kube/configs", dir)
+func TestCreateDir(t *testing.T) {
+	t.Run("should restrict the default directory but leave a given one as it is", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.CreateDirIfNotExist("/Users/test/.kube/configs"))
+		assert.Nil(t, fs.CreateDirIfNotExist("/Users/test/kube"))
+		kubeCfg, _ := kubeconfig.New(fs, nil)
+		custom := kubeCfg.WithDir("/Users/test/kube")
+
+		assert.Nil(t, kubeCfg.CreateDir())
+		assert.Nil(t, custom.CreateDir())
+
+		info, _ := fs.Stat("/Users/test/.kube/configs")
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+		info, _ = fs.Stat("/Users/test/kube")
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
 	})
 }
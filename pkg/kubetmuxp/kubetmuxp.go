@@ -1,12 +1,22 @@
 package kubetmuxp
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
+	"os"
 	"path"
+	"reflect"
+	"strings"
 
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/tmuxp"
 	yamlV2 "gopkg.in/yaml.v2"
 )
@@ -14,13 +24,45 @@ import (
 // Envs reprensents environemnt variables
 type Envs map[string]string
 
-//Cluster represents a Kubernetes cluster
+// Endpoints of the control plane of GKE clusters that kubeconfigs can use
+const (
+	PublicEndpoint   = "public"
+	InternalEndpoint = "internal"
+	DNSEndpoint      = "dns"
+)
+
+// ImpersonatedServiceAccountEnv is the tmuxp env holding the service
+// account impersonated for the cluster of the session, if any
+const ImpersonatedServiceAccountEnv = "KUBETMUXP_IMPERSONATED_SERVICE_ACCOUNT"
+
+// PromptHintEnv is the tmuxp env holding a hint to show in the shell
+// prompt of the session, like the impersonated service account
+const PromptHintEnv = "KUBETMUXP_PROMPT_HINT"
+
+// Cluster represents a Kubernetes cluster
 type Cluster struct {
 	Name    string `yaml:"name"`
 	Zone    string `yaml:"zone,omitempty"`
 	Region  string `yaml:"region,omitempty"`
 	Context string `yaml:"context"`
-	Envs    `yaml:"envs,omitempty"`
+	// ImpersonateServiceAccount is the service account impersonated
+	// for the cluster instead of the one of its project
+	ImpersonateServiceAccount string `yaml:"impersonateServiceAccount,omitempty"`
+	// Endpoint is the endpoint of the control plane the kubeconfig
+	// uses: public, the default, internal or dns
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// ProxyURL is the proxy, like a bastion, the kubeconfig
+	// reaches the cluster through
+	ProxyURL string `yaml:"proxyURL,omitempty"`
+	Envs     `yaml:"envs,omitempty"`
+}
+
+// endpoint returns the endpoint of the control plane the kubeconfig uses
+func (c *Cluster) endpoint() string {
+	if c.Endpoint == "" {
+		return PublicEndpoint
+	}
+	return c.Endpoint
 }
 
 // DefaultContextName returns default context name
@@ -47,37 +89,291 @@ func (c *Cluster) IsRegional() (bool, error) {
 	return false, nil
 }
 
+// hash returns a checksum of the fields of the cluster and its
+// project that affect the generated kubeconfig
+func (c *Cluster) hash(project Project) string {
+	definition := struct {
+		Project                   string
+		Name                      string
+		Zone                      string
+		Region                    string
+		Context                   string
+		Account                   string `json:",omitempty"`
+		GCloudConfiguration       string `json:",omitempty"`
+		ImpersonateServiceAccount string `json:",omitempty"`
+		Endpoint                  string `json:",omitempty"`
+		ProxyURL                  string `json:",omitempty"`
+	}{project.Name, c.Name, c.Zone, c.Region, c.Context, project.Account, project.GCloudConfiguration, project.ImpersonateServiceAccount, "", c.ProxyURL}
+	if c.endpoint() != PublicEndpoint {
+		definition.Endpoint = c.endpoint()
+	}
+	data, _ := json.Marshal(definition)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
 // Clusters represents a list of Kubernetes clusters
 type Clusters []Cluster
 
-//Project represents a cloud project
+// Project represents a cloud project
 type Project struct {
-	Name     string `yaml:"name"`
-	Clusters `yaml:"clusters"`
+	Name string `yaml:"name"`
+	// Account is the gcloud account used for the project
+	// instead of the active one
+	Account string `yaml:"account,omitempty"`
+	// GCloudConfiguration is the gcloud configuration used
+	// for the project instead of the active one
+	GCloudConfiguration string `yaml:"gcloudConfiguration,omitempty"`
+	// ImpersonateServiceAccount is the service account impersonated
+	// for the clusters of the project
+	ImpersonateServiceAccount string `yaml:"impersonateServiceAccount,omitempty"`
+	Clusters                  `yaml:"clusters"`
+}
+
+// forCluster returns the name and identity of the project the cluster is
+// fetched with, impersonating the service account of the cluster if any
+func (p Project) forCluster(cluster Cluster) Project {
+	serviceAccount := p.ImpersonateServiceAccount
+	if cluster.ImpersonateServiceAccount != "" {
+		serviceAccount = cluster.ImpersonateServiceAccount
+	}
+	return Project{
+		Name:                      p.Name,
+		Account:                   p.Account,
+		GCloudConfiguration:       p.GCloudConfiguration,
+		ImpersonateServiceAccount: serviceAccount,
+	}
 }
 
-//Projects represents a list of cloud projects
+// authEnv returns the envs making gke-gcloud-auth-plugin use the
+// account and configuration of the project and impersonate its
+// service account
+func (p Project) authEnv() []kubeconfig.ExecEnv {
+	var env []kubeconfig.ExecEnv
+	if p.ImpersonateServiceAccount != "" {
+		env = append(env, kubeconfig.ExecEnv{Name: "CLOUDSDK_AUTH_IMPERSONATE_SERVICE_ACCOUNT", Value: p.ImpersonateServiceAccount})
+	}
+	if p.GCloudConfiguration != "" {
+		env = append(env, kubeconfig.ExecEnv{Name: "CLOUDSDK_ACTIVE_CONFIG_NAME", Value: p.GCloudConfiguration})
+	}
+	if p.Account != "" {
+		env = append(env, kubeconfig.ExecEnv{Name: "CLOUDSDK_CORE_ACCOUNT", Value: p.Account})
+	}
+	return env
+}
+
+// Projects represents a list of cloud projects
 type Projects []Project
 
+// Changes represents the contexts whose clusters differ between two configs
+type Changes struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// Empty tells if there are no changes
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// String returns a concise diff of the changes
+func (c Changes) String() string {
+	var lines []string
+	for _, ctx := range c.Added {
+		lines = append(lines, fmt.Sprintf("+ %s", ctx))
+	}
+	for _, ctx := range c.Changed {
+		lines = append(lines, fmt.Sprintf("~ %s", ctx))
+	}
+	for _, ctx := range c.Removed {
+		lines = append(lines, fmt.Sprintf("- %s", ctx))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type resolvedCluster struct {
+	project Project
+	cluster Cluster
+}
+
+func resolve(projects Projects) (map[string]resolvedCluster, []string) {
+	resolved := map[string]resolvedCluster{}
+	var order []string
+	for _, project := range projects {
+		for _, cluster := range project.Clusters {
+			resolved[cluster.Context] = resolvedCluster{project: project.forCluster(cluster), cluster: cluster}
+			order = append(order, cluster.Context)
+		}
+	}
+	return resolved, order
+}
+
+// Diff compares the clusters of two configs by their contexts
+func Diff(old, new Projects) Changes {
+	oldClusters, oldOrder := resolve(old)
+	newClusters, newOrder := resolve(new)
+
+	changes := Changes{}
+	for _, ctx := range newOrder {
+		oldCluster, ok := oldClusters[ctx]
+		if !ok {
+			changes.Added = append(changes.Added, ctx)
+		} else if !reflect.DeepEqual(oldCluster, newClusters[ctx]) {
+			changes.Changed = append(changes.Changed, ctx)
+		}
+	}
+	for _, ctx := range oldOrder {
+		if _, ok := newClusters[ctx]; !ok {
+			changes.Removed = append(changes.Removed, ctx)
+		}
+	}
+	return changes
+}
+
+// Output represents the directories in which the generated files are stored
+type Output struct {
+	KubeconfigDir string `yaml:"kubeconfigDir,omitempty"`
+	TmuxpDir      string `yaml:"tmuxpDir,omitempty"`
+}
+
+// Or returns the output with its empty fields taken from other
+func (o Output) Or(other Output) Output {
+	if o.KubeconfigDir == "" {
+		o.KubeconfigDir = other.KubeconfigDir
+	}
+	if o.TmuxpDir == "" {
+		o.TmuxpDir = other.TmuxpDir
+	}
+	return o
+}
+
+// OutputFromEnv returns the output directories set
+// through environment variables
+func OutputFromEnv() Output {
+	return Output{
+		KubeconfigDir: os.Getenv("KUBE_TMUXP_KUBECONFIG_DIR"),
+		TmuxpDir:      os.Getenv("KUBE_TMUXP_TMUXP_DIR"),
+	}
+}
+
+// ClusterLookup finds what is needed to connect to GKE clusters
+// through the given endpoint of their control plane
+type ClusterLookup interface {
+	Lookup(ctx context.Context, project Project, name string, location string, endpoint string) (kubeconfig.GKECluster, error)
+}
+
 // Config represents kube-tmuxp config
 type Config struct {
+	Output     Output                `yaml:"output,omitempty"`
+	Retry      commander.RetryPolicy `yaml:"retry,omitempty"`
 	Projects   `yaml:"projects"`
 	filesystem filesystem.FileSystem
 	kubeCfg    kubeconfig.KubeConfig
+	clusters   ClusterLookup
+	log        *logging.Logger
 }
 
-func (c *Config) load(cfgFile string) error {
-	reader, err := c.filesystem.Open(cfgFile)
+// Summary tells what a run of Process did
+type Summary struct {
+	Fetched  int
+	UpToDate int
+	Retries  int
+}
+
+// SetOutput overrides the output directories of the config
+// with the non empty fields of the given output
+func (c *Config) SetOutput(output Output) error {
+	c.Output = output.Or(c.Output)
+	for _, dir := range []*string{&c.Output.KubeconfigDir, &c.Output.TmuxpDir} {
+		expanded, err := c.expandHome(os.ExpandEnv(*dir))
+		if err != nil {
+			return err
+		}
+		*dir = expanded
+	}
+
+	if c.Output.KubeconfigDir != "" {
+		c.kubeCfg = c.kubeCfg.WithDir(c.Output.KubeconfigDir)
+	}
+	return nil
+}
+
+func (c *Config) expandHome(dir string) (string, error) {
+	if dir != "~" && !strings.HasPrefix(dir, "~/") {
+		return dir, nil
+	}
+
+	home, err := c.filesystem.HomeDir()
 	if err != nil {
-		return err
+		return "", err
 	}
+	return path.Join(home, strings.TrimPrefix(dir, "~")), nil
+}
 
-	data, err := ioutil.ReadAll(reader)
+// SetClusterLookup sets where the endpoints of the clusters
+// are found when their kubeconfigs are written
+func (c *Config) SetClusterLookup(clusters ClusterLookup) {
+	c.clusters = clusters
+}
+
+// KubeConfig returns the KubeConfig that stores the kube configs
+// in the output directory of the config
+func (c *Config) KubeConfig() kubeconfig.KubeConfig {
+	return c.kubeCfg
+}
+
+// TmuxpDir returns the directory in which tmuxp configs are stored
+func (c *Config) TmuxpDir() (string, error) {
+	if c.Output.TmuxpDir != "" {
+		return c.Output.TmuxpDir, nil
+	}
+	return tmuxp.DefaultConfigsDir(c.filesystem)
+}
+
+// TmuxpConfigFile returns the tmuxp config file of the given context
+func (c *Config) TmuxpConfigFile(context string) (string, error) {
+	tmuxpCfgsDir, err := c.TmuxpDir()
+	if err != nil {
+		return "", err
+	}
+	return tmuxpConfigFile(tmuxpCfgsDir, context), nil
+}
+
+func tmuxpConfigFile(tmuxpCfgsDir, context string) string {
+	return path.Join(tmuxpCfgsDir, fmt.Sprintf("%s.yaml", context))
+}
+
+// Sessions returns the names of the tmuxp configs in the tmuxp
+// directory, which include the contexts generated so far
+func (c *Config) Sessions() ([]string, error) {
+	tmuxpCfgsDir, err := c.TmuxpDir()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := c.filesystem.ReadDir(tmuxpCfgsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []string
+	for _, info := range infos {
+		if name := info.Name(); !info.IsDir() && path.Ext(name) == ".yaml" && !strings.HasPrefix(name, ".") {
+			sessions = append(sessions, strings.TrimSuffix(name, ".yaml"))
+		}
+	}
+	return sessions, nil
+}
+
+func (c *Config) load(cfgFile string) error {
+	data, err := c.readFile(cfgFile)
 	if err != nil {
 		return err
 	}
 
-	err = yamlV2.Unmarshal(data, c)
+	err = yamlV2.Unmarshal([]byte(data), c)
 	if err != nil {
 		return err
 	}
@@ -85,87 +381,321 @@ func (c *Config) load(cfgFile string) error {
 	return nil
 }
 
-func (c *Config) saveTmuxpConfig(kubeCfgFile string, cluster Cluster) error {
+func (c *Config) saveTmuxpConfig(kubeCfgFile string, project Project, cluster Cluster) error {
 	windows := tmuxp.Windows{{Name: "default"}}
 	env := tmuxp.Environment{"KUBECONFIG": kubeCfgFile}
+	if project.ImpersonateServiceAccount != "" {
+		env[ImpersonatedServiceAccountEnv] = project.ImpersonateServiceAccount
+		env[PromptHintEnv] = "as " + project.ImpersonateServiceAccount
+	}
 	for k, v := range cluster.Envs {
 		env[k] = v
 	}
 
-	tmuxpCfg, err := tmuxp.NewConfig(cluster.Context, windows, env, c.filesystem)
+	tmuxpCfgsDir, err := c.TmuxpDir()
+	if err != nil {
+		return err
+	}
+	tmuxpCfg, err := tmuxp.NewConfigInDir(cluster.Context, windows, env, c.filesystem, tmuxpCfgsDir)
 	if err != nil {
 		return err
 	}
 
-	tmuxpCfgFile := path.Join(tmuxpCfg.TmuxpConfigsDir(), fmt.Sprintf("%s.yaml", cluster.Context))
+	tmuxpCfgFile := tmuxpConfigFile(tmuxpCfg.TmuxpConfigsDir(), cluster.Context)
 	if err := tmuxpCfg.Save(tmuxpCfgFile); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Process processes kube-tmuxp configs
-func (c *Config) Process() error {
-	kubeCfgsDir := c.kubeCfg.KubeCfgsDir()
+// Contexts returns the names of all the contexts in the config
+func (c *Config) Contexts() []string {
+	var contexts []string
 	for _, project := range c.Projects {
 		for _, cluster := range project.Clusters {
-			kubeCfgFile := path.Join(kubeCfgsDir, cluster.Context)
-
-			fmt.Printf("Cluster: %s\n", cluster.Name)
-			fmt.Println("Deleting exisiting context...")
-			if err := c.kubeCfg.Delete(kubeCfgFile); err != nil {
-				return err
-			}
+			contexts = append(contexts, cluster.Context)
+		}
+	}
+	return contexts
+}
 
-			fmt.Println("Adding context...")
-			if regional, err := cluster.IsRegional(); err != nil {
-				return err
-			} else if regional {
-				if err := c.kubeCfg.AddRegionalCluster(project.Name, cluster.Name, cluster.Region, kubeCfgFile); err != nil {
-					return err
-				}
+// Validate checks the kube-tmuxp config for mistakes
+// that would make Process fail or overwrite contexts
+func (c *Config) Validate() error {
+	var problems []string
+	contexts := map[string]bool{}
+	for i, project := range c.Projects {
+		if project.Name == "" {
+			problems = append(problems, fmt.Sprintf("project #%d: name is missing", i+1))
+		}
+		if project.ImpersonateServiceAccount != "" && !strings.Contains(project.ImpersonateServiceAccount, "@") {
+			problems = append(problems, fmt.Sprintf("project %q: impersonateServiceAccount %q should be the email of a service account", project.Name, project.ImpersonateServiceAccount))
+		}
+		for j, cluster := range project.Clusters {
+			id := fmt.Sprintf("project %q cluster #%d", project.Name, j+1)
+			if cluster.Name != "" {
+				id = fmt.Sprintf("project %q cluster %q", project.Name, cluster.Name)
 			} else {
-				if err := c.kubeCfg.AddZonalCluster(project.Name, cluster.Name, cluster.Zone, kubeCfgFile); err != nil {
-					return err
+				problems = append(problems, fmt.Sprintf("%s: name is missing", id))
+			}
+			if (cluster.Zone == "") == (cluster.Region == "") {
+				problems = append(problems, fmt.Sprintf("%s: exactly one of region or zone should be given", id))
+			}
+			if cluster.ImpersonateServiceAccount != "" && !strings.Contains(cluster.ImpersonateServiceAccount, "@") {
+				problems = append(problems, fmt.Sprintf("%s: impersonateServiceAccount %q should be the email of a service account", id, cluster.ImpersonateServiceAccount))
+			}
+			switch cluster.endpoint() {
+			case PublicEndpoint, InternalEndpoint, DNSEndpoint:
+			default:
+				problems = append(problems, fmt.Sprintf("%s: endpoint %q should be one of %s, %s or %s", id, cluster.Endpoint, PublicEndpoint, InternalEndpoint, DNSEndpoint))
+			}
+			if cluster.ProxyURL != "" {
+				if proxyURL, err := url.Parse(cluster.ProxyURL); err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5") || proxyURL.Host == "" {
+					problems = append(problems, fmt.Sprintf("%s: proxyURL %q should be an http, https or socks5 URL", id, cluster.ProxyURL))
 				}
 			}
+			if cluster.Context == "" {
+				problems = append(problems, fmt.Sprintf("%s: context is missing", id))
+			} else if contexts[cluster.Context] {
+				problems = append(problems, fmt.Sprintf("%s: context %q is used by more than one cluster", id, cluster.Context))
+			}
+			contexts[cluster.Context] = true
+		}
+	}
+	problems = append(problems, c.Retry.Validate()...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n %s", strings.Join(problems, "\n "))
+	}
+	return nil
+}
 
-			fmt.Println("Renaming context...")
-			defaultCtxName, err := cluster.DefaultContextName(project.Name)
+// Process processes kube-tmuxp configs. Kubeconfigs of clusters
+// whose definition has not changed since they were generated are
+// not fetched again unless force is true.
+func (c *Config) Process(ctx context.Context, force bool) error {
+	summary := Summary{}
+	retries := c.retries()
+	for _, project := range c.Projects {
+		for _, cluster := range project.Clusters {
+			fetched, err := c.processCluster(ctx, project, cluster, force)
 			if err != nil {
 				return err
 			}
-			c.kubeCfg.RenameContext(defaultCtxName, cluster.Context, kubeCfgFile)
+			if fetched {
+				summary.Fetched++
+			} else {
+				summary.UpToDate++
+			}
+		}
+	}
+
+	summary.Retries = c.retries() - retries
+	c.log.Info("Summary", "fetched", summary.Fetched, "upToDate", summary.UpToDate, "retried", summary.Retries)
+	return nil
+}
+
+// retries returns the number of commands retried so far
+func (c *Config) retries() int {
+	if counter, ok := c.kubeCfg.Commander().(interface{ Retries() int }); ok {
+		return counter.Retries()
+	}
+	return 0
+}
 
-			fmt.Println("Creating tmuxp config...")
-			c.saveTmuxpConfig(kubeCfgFile, cluster)
+// useRetries makes the commands fetching kubeconfigs retry
+// transient failures according to the retry policy
+func (c *Config) useRetries() error {
+	retrying, err := commander.NewRetrying(c.kubeCfg.Commander(), c.Retry, c.log)
+	if err != nil {
+		return err
+	}
+	c.kubeCfg = c.kubeCfg.WithCommander(retrying)
+	return nil
+}
 
-			fmt.Println("")
+// Refresh fetches the kubeconfigs of the given contexts again
+func (c *Config) Refresh(ctx context.Context, contexts []string) error {
+	return c.ProcessContexts(ctx, contexts, true)
+}
+
+// ProcessContexts processes the clusters of the given contexts like
+// Process, fetching their kubeconfigs only if their definition changed
+// since they were generated, unless force is true
+func (c *Config) ProcessContexts(ctx context.Context, contexts []string, force bool) error {
+	selected := map[string]bool{}
+	for _, name := range contexts {
+		selected[name] = true
+	}
+
+	for _, project := range c.Projects {
+		for _, cluster := range project.Clusters {
+			if !selected[cluster.Context] {
+				continue
+			}
+			if _, err := c.processCluster(ctx, project, cluster, force); err != nil {
+				return err
+			}
+			delete(selected, cluster.Context)
 		}
 	}
 
+	for _, name := range contexts {
+		if selected[name] {
+			return fmt.Errorf("context %s not found in config", name)
+		}
+	}
 	return nil
 }
 
-// NewConfig creates a new kube-tmuxp Config
-func NewConfig(cfgFile string, fs filesystem.FileSystem, kubeCfg kubeconfig.KubeConfig) (Config, error) {
+// Restore rolls the kubeconfig of the given context back to its latest
+// backup. The stored hash of the cluster is removed so that the next
+// Process fetches the kubeconfig again.
+func (c *Config) Restore(context string) (string, error) {
+	backup, err := c.kubeCfg.Restore(context)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.filesystem.Remove(c.hashFile(Cluster{Context: context})); err != nil && !os.IsNotExist(err) {
+		return backup, err
+	}
+	return backup, nil
+}
+
+func (c *Config) hashFile(cluster Cluster) string {
+	return path.Join(c.kubeCfg.KubeCfgsDir(), fmt.Sprintf(".%s.hash", cluster.Context))
+}
+
+func (c *Config) readFile(file string) (string, error) {
+	reader, err := c.filesystem.Open(file)
+	if err != nil {
+		return "", err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// isUpToDate tells if the kubeconfig of the cluster exists and was
+// generated from the same cluster definition
+func (c *Config) isUpToDate(project Project, cluster Cluster, kubeCfgFile string) bool {
+	if _, err := c.readFile(kubeCfgFile); err != nil {
+		return false
+	}
+	hash, err := c.readFile(c.hashFile(cluster))
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(hash) == cluster.hash(project)
+}
+
+// processCluster fetches the kubeconfig of the cluster unless it is
+// up to date and writes its tmuxp config. It tells if it fetched.
+func (c *Config) processCluster(ctx context.Context, project Project, cluster Cluster, force bool) (bool, error) {
+	project = project.forCluster(cluster)
+	kubeCfgFile := path.Join(c.kubeCfg.KubeCfgsDir(), cluster.Context)
+	log := c.log.With("cluster", cluster.Name, "context", cluster.Context)
+
+	fetched := force || !c.isUpToDate(project, cluster, kubeCfgFile)
+	if !fetched {
+		log.Info("Kubeconfig is up to date, skipping fetch")
+	} else if err := c.fetchKubeConfig(ctx, project, cluster, kubeCfgFile, log); err != nil {
+		return false, err
+	} else {
+		log.Info("Fetched kubeconfig", "file", kubeCfgFile)
+	}
+
+	log.Debug("Creating tmuxp config")
+	if err := c.saveTmuxpConfig(kubeCfgFile, project, cluster); err != nil {
+		return fetched, err
+	}
+	return fetched, nil
+}
+
+// fetchKubeConfig writes the kubeconfig of the cluster, found through the
+// cluster lookup, into a temporary directory and moves it in place only
+// when it is complete, so that a failure leaves the existing kubeconfig
+// untouched
+func (c *Config) fetchKubeConfig(ctx context.Context, project Project, cluster Cluster, kubeCfgFile string, log *logging.Logger) error {
+	if err := c.kubeCfg.CreateDir(); err != nil {
+		return err
+	}
+	tmpDir, err := c.filesystem.TempDir(c.kubeCfg.KubeCfgsDir(), ".kube-tmuxp-")
+	if err != nil {
+		return err
+	}
+	tmpFile := path.Join(tmpDir, cluster.Context)
+	defer func() {
+		_ = c.kubeCfg.Delete(tmpFile)
+		_ = c.filesystem.Remove(tmpDir)
+	}()
+
+	if c.clusters == nil {
+		return fmt.Errorf("cannot fetch kubeconfig of cluster %s: no cluster lookup set", cluster.Name)
+	}
+	location := cluster.Zone
+	if regional, err := cluster.IsRegional(); err != nil {
+		return err
+	} else if regional {
+		location = cluster.Region
+	}
+	gkeCluster, err := c.clusters.Lookup(ctx, project, cluster.Name, location, cluster.endpoint())
+	if err != nil {
+		return err
+	}
+	gkeCluster.ProxyURL = cluster.ProxyURL
+
+	defaultCtxName, err := cluster.DefaultContextName(project.Name)
+	if err != nil {
+		return err
+	}
+	log.Debug("Writing kubeconfig", "file", tmpFile, "endpoint", gkeCluster.Endpoint)
+	if err := c.kubeCfg.Write(tmpFile, kubeconfig.NewGKEFile(defaultCtxName, cluster.Context, gkeCluster, project.authEnv()...)); err != nil {
+		return err
+	}
+
+	log.Debug("Replacing existing kubeconfig", "file", kubeCfgFile)
+	if err := c.kubeCfg.Replace(tmpFile, kubeCfgFile); err != nil {
+		return err
+	}
+
+	return filesystem.WriteFile(c.filesystem, c.hashFile(cluster), []byte(cluster.hash(project)+"\n"))
+}
+
+// NewConfig creates a new kube-tmuxp Config that logs its progress to log
+func NewConfig(cfgFile string, fs filesystem.FileSystem, kubeCfg kubeconfig.KubeConfig, log *logging.Logger) (Config, error) {
 	cfg := Config{
 		filesystem: fs,
 		kubeCfg:    kubeCfg,
+		log:        log,
 	}
 
 	if err := cfg.load(cfgFile); err != nil {
 		return cfg, err
 	}
+	if err := cfg.useRetries(); err != nil {
+		return cfg, err
+	}
 
+	if err := cfg.SetOutput(Output{}); err != nil {
+		return cfg, err
+	}
 	return cfg, nil
 }
 
 // NewConfig creates a new kube-tmuxp Config for the given projects
-func NewConfigWithProjects(projects Projects, fs filesystem.FileSystem, kubeCfg kubeconfig.KubeConfig) (Config, error) {
+func NewConfigWithProjects(projects Projects, fs filesystem.FileSystem, kubeCfg kubeconfig.KubeConfig, log *logging.Logger) (Config, error) {
 	cfg := Config{
 		filesystem: fs,
 		kubeCfg:    kubeCfg,
+		log:        log,
 		Projects:   projects,
 	}
 	return cfg, nil
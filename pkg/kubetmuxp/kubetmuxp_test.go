@@ -1,15 +1,22 @@
 package kubetmuxp_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/commander"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/gcloud"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
 )
 
 func getKubeCfg(ctrl *gomock.Controller) kubeconfig.KubeConfig {
@@ -29,7 +36,7 @@ func TestNewConfig(t *testing.T) {
 		reader := strings.NewReader("")
 		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(reader, nil)
 
-		kubetmuxpCfg, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{})
+		kubetmuxpCfg, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{}, nil)
 
 		assert.Nil(t, err)
 		assert.NotNil(t, kubetmuxpCfg)
@@ -42,7 +49,7 @@ func TestNewConfig(t *testing.T) {
 		mockFS := mock.NewFileSystem(ctrl)
 		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(nil, fmt.Errorf("some error"))
 
-		_, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{})
+		_, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{}, nil)
 
 		assert.EqualError(t, err, "some error")
 	})
@@ -64,7 +71,7 @@ projects:
       TEST_ENV: test-value`
 		reader := strings.NewReader(content)
 		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(reader, nil)
-		kubetmuxpCfg, _ := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{})
+		kubetmuxpCfg, _ := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{}, nil)
 
 		expectedProjects := kubetmuxp.Projects{
 			{
@@ -93,12 +100,68 @@ projects:
 		mockFS := mock.NewFileSystem(ctrl)
 		reader := strings.NewReader("invalid yaml")
 		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(reader, nil)
-		_, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{})
+		_, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeconfig.KubeConfig{}, nil)
 
 		assert.NotNil(t, err)
 	})
 }
 
+func TestSetOutput(t *testing.T) {
+	content := `
+output:
+  kubeconfigDir: ~/kubeconfigs
+  tmuxpDir: /Users/test/tmuxp
+projects: []`
+
+	t.Run("should use the output directories of the config file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil).Times(2)
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(strings.NewReader(content), nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+
+		cfg, err := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeCfg, nil)
+
+		assert.Nil(t, err)
+		kubeCfg = cfg.KubeConfig()
+		assert.Equal(t, "/Users/test/kubeconfigs", kubeCfg.KubeCfgsDir())
+		tmuxpDir, _ := cfg.TmuxpDir()
+		assert.Equal(t, "/Users/test/tmuxp", tmuxpDir)
+	})
+
+	t.Run("should override the output directories of the config file", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil).AnyTimes()
+		mockFS.EXPECT().Open("kube-tmuxp-config.yaml").Return(strings.NewReader(content), nil)
+		kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+		cfg, _ := kubetmuxp.NewConfig("kube-tmuxp-config.yaml", mockFS, kubeCfg, nil)
+
+		err := cfg.SetOutput(kubetmuxp.Output{TmuxpDir: "/tmp/tmuxp"})
+
+		assert.Nil(t, err)
+		kubeCfg = cfg.KubeConfig()
+		assert.Equal(t, "/Users/test/kubeconfigs", kubeCfg.KubeCfgsDir())
+		tmuxpDir, _ := cfg.TmuxpDir()
+		assert.Equal(t, "/tmp/tmuxp", tmuxpDir)
+	})
+
+	t.Run("should prefer flags over environment variables", func(t *testing.T) {
+		defer os.Setenv("KUBE_TMUXP_KUBECONFIG_DIR", os.Getenv("KUBE_TMUXP_KUBECONFIG_DIR"))
+		defer os.Setenv("KUBE_TMUXP_TMUXP_DIR", os.Getenv("KUBE_TMUXP_TMUXP_DIR"))
+		os.Setenv("KUBE_TMUXP_KUBECONFIG_DIR", "/env/kubeconfigs")
+		os.Setenv("KUBE_TMUXP_TMUXP_DIR", "/env/tmuxp")
+
+		output := kubetmuxp.Output{TmuxpDir: "/flag/tmuxp"}.Or(kubetmuxp.OutputFromEnv())
+
+		assert.Equal(t, kubetmuxp.Output{KubeconfigDir: "/env/kubeconfigs", TmuxpDir: "/flag/tmuxp"}, output)
+	})
+}
+
 func TestIsRegional(t *testing.T) {
 	t.Run("should return true when region alone is given", func(t *testing.T) {
 		cluster := kubetmuxp.Cluster{
@@ -174,3 +237,522 @@ func TestGeneratedContextName(t *testing.T) {
 		assert.EqualError(t, err, "Only one of region or zone should be given")
 	})
 }
+
+func TestValidate(t *testing.T) {
+	t.Run("should accept a valid config", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(kubetmuxp.Projects{
+			{
+				Name: "test-project",
+				Clusters: kubetmuxp.Clusters{
+					{Name: "zonal-cluster", Zone: "test-zone", Context: "zonal-ctx"},
+					{Name: "regional-cluster", Region: "test-region", Context: "regional-ctx"},
+				},
+			},
+		}, nil, kubeconfig.KubeConfig{}, nil)
+
+		assert.Nil(t, cfg.Validate())
+	})
+
+	t.Run("should report invalid retry policies", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(kubetmuxp.Projects{}, nil, kubeconfig.KubeConfig{}, nil)
+		cfg.Retry = commander.RetryPolicy{MaxAttempts: -1, Patterns: []string{"quota("}}
+
+		err := cfg.Validate()
+
+		assert.EqualError(t, err, `invalid config:
+ retry: maxAttempts should not be negative
+ retry: invalid pattern "quota(": error parsing regexp: missing closing ): `+"`quota(`")
+	})
+
+	t.Run("should report unknown endpoints and invalid proxy URLs", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(kubetmuxp.Projects{
+			{
+				Name: "test-project",
+				Clusters: kubetmuxp.Clusters{
+					{Name: "test-cluster", Zone: "test-zone", Context: "test-ctx", Endpoint: "private", ProxyURL: "bastion:8888"},
+					{Name: "proxied-cluster", Zone: "test-zone", Context: "proxied-ctx", Endpoint: "internal", ProxyURL: "socks5://localhost:1080"},
+				},
+			},
+		}, nil, kubeconfig.KubeConfig{}, nil)
+
+		err := cfg.Validate()
+
+		assert.EqualError(t, err, `invalid config:
+ project "test-project" cluster "test-cluster": endpoint "private" should be one of public, internal or dns
+ project "test-project" cluster "test-cluster": proxyURL "bastion:8888" should be an http, https or socks5 URL`)
+	})
+
+	t.Run("should report service accounts to impersonate that are not emails", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(kubetmuxp.Projects{
+			{
+				Name:                      "test-project",
+				ImpersonateServiceAccount: "break-glass",
+				Clusters: kubetmuxp.Clusters{
+					{Name: "test-cluster", Zone: "test-zone", Context: "test-ctx", ImpersonateServiceAccount: "admin"},
+				},
+			},
+		}, nil, kubeconfig.KubeConfig{}, nil)
+
+		err := cfg.Validate()
+
+		assert.EqualError(t, err, `invalid config:
+ project "test-project": impersonateServiceAccount "break-glass" should be the email of a service account
+ project "test-project" cluster "test-cluster": impersonateServiceAccount "admin" should be the email of a service account`)
+	})
+
+	t.Run("should report all the problems in the config", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(kubetmuxp.Projects{
+			{
+				Clusters: kubetmuxp.Clusters{
+					{Zone: "test-zone", Region: "test-region", Context: "test-ctx"},
+				},
+			},
+			{
+				Name: "test-project",
+				Clusters: kubetmuxp.Clusters{
+					{Name: "no-location", Context: "test-ctx"},
+					{Name: "no-context", Zone: "test-zone"},
+				},
+			},
+		}, nil, kubeconfig.KubeConfig{}, nil)
+
+		err := cfg.Validate()
+
+		assert.EqualError(t, err, `invalid config:
+ project #1: name is missing
+ project "" cluster #1: name is missing
+ project "" cluster #1: exactly one of region or zone should be given
+ project "test-project" cluster "no-location": exactly one of region or zone should be given
+ project "test-project" cluster "no-location": context "test-ctx" is used by more than one cluster
+ project "test-project" cluster "no-context": context is missing`)
+	})
+}
+
+// expectClusters makes gcloud list the clusters of the project as given
+func expectClusters(mockCmdr *mock.Commander, project string, clusters string) *gomock.Call {
+	return mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", project, "--format=json"}, nil).Return(clusters, nil)
+}
+
+// lookUpClusters makes the config find clusters with gcloud
+func lookUpClusters(cfg *kubetmuxp.Config) {
+	cfg.SetClusterLookup(gcloud.NewClusterLookup(cfg.KubeConfig().Commander()))
+}
+
+func readFile(t *testing.T, fs *filesystem.Memory, file string) string {
+	data, err := fs.ReadFile(file)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func fileNames(t *testing.T, fs *filesystem.Memory, dir string) []string {
+	infos, err := fs.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestRefresh(t *testing.T) {
+	projects := kubetmuxp.Projects{
+		{
+			Name: "test-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "first-cluster", Zone: "test-zone", Context: "first-ctx"},
+				{Name: "second-cluster", Region: "test-region", Context: "second-ctx"},
+			},
+		},
+	}
+
+	t.Run("should process only the clusters of the given contexts", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		expectClusters(mockCmdr, "test-project", `[{"name": "second-cluster", "location": "test-region", "endpoint": "10.0.0.2", "masterAuth": {"clusterCaCertificate": "Y2EtZGF0YQ=="}}]`)
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Refresh(context.Background(), []string{"second-ctx"})
+
+		assert.Nil(t, err)
+		file, err := kubeCfg.Read("/Users/test/.kube/configs/second-ctx")
+		assert.Nil(t, err)
+		assert.Equal(t, kubeconfig.NewGKEFile("gke_test-project_test-region_second-cluster", "second-ctx", kubeconfig.GKECluster{Endpoint: "10.0.0.2", CACertificate: "Y2EtZGF0YQ=="}), file)
+		info, _ := fs.Stat("/Users/test/.kube/configs/second-ctx")
+		assert.Equal(t, os.FileMode(0600), info.Mode())
+		assert.Equal(t, []string{".second-ctx.hash", "second-ctx"}, fileNames(t, fs, "/Users/test/.kube/configs"))
+		assert.Equal(t, []string{"second-ctx.yaml"}, fileNames(t, fs, "/Users/test/.tmuxp"))
+		assert.Contains(t, readFile(t, fs, "/Users/test/.tmuxp/second-ctx.yaml"), "session_name: second-ctx")
+	})
+
+	t.Run("should return error if a context is not in the config", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, nil, kubeconfig.KubeConfig{}, nil)
+
+		err := cfg.Refresh(context.Background(), []string{"unknown-ctx"})
+
+		assert.EqualError(t, err, "context unknown-ctx not found in config")
+	})
+
+	t.Run("should return error and leave no files behind if the cluster is not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		expectClusters(mockCmdr, "test-project", `[{"name": "first-cluster", "location": "another-zone", "endpoint": "10.0.0.1"}]`)
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Refresh(context.Background(), []string{"first-ctx"})
+
+		assert.EqualError(t, err, "cluster first-cluster not found in test-zone of project test-project")
+		assert.Empty(t, fileNames(t, fs, "/Users/test/.kube/configs"))
+	})
+
+	t.Run("should list the clusters of a project only once", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		expectClusters(mockCmdr, "test-project", `[
+  {"name": "first-cluster", "location": "test-zone", "endpoint": "10.0.0.1"},
+  {"name": "second-cluster", "location": "test-region", "endpoint": "10.0.0.2"}
+]`).Times(1)
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Refresh(context.Background(), []string{"first-ctx", "second-ctx"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{".first-ctx.hash", ".second-ctx.hash", "first-ctx", "second-ctx"}, fileNames(t, fs, "/Users/test/.kube/configs"))
+	})
+}
+
+func TestSessions(t *testing.T) {
+	t.Run("should return the names of the tmuxp configs in the tmuxp directory", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.AddFile("/Users/test/.tmuxp/test-ctx.yaml", nil, 0600))
+		assert.Nil(t, fs.AddFile("/Users/test/.tmuxp/another-ctx.yaml", nil, 0600))
+		assert.Nil(t, fs.AddFile("/Users/test/.tmuxp/.test-ctx.yaml.tmp-1", nil, 0600))
+		assert.Nil(t, fs.AddFile("/Users/test/.tmuxp/notes.txt", nil, 0600))
+		cfg, _ := kubetmuxp.NewConfigWithProjects(nil, fs, kubeconfig.KubeConfig{}, nil)
+		assert.Nil(t, cfg.SetOutput(kubetmuxp.Output{TmuxpDir: "/Users/test/.tmuxp"}))
+
+		sessions, err := cfg.Sessions()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"another-ctx", "test-ctx"}, sessions)
+		file, err := cfg.TmuxpConfigFile("test-ctx")
+		assert.Nil(t, err)
+		assert.Equal(t, "/Users/test/.tmuxp/test-ctx.yaml", file)
+	})
+
+	t.Run("should return no sessions if the tmuxp directory does not exist", func(t *testing.T) {
+		cfg, _ := kubetmuxp.NewConfigWithProjects(nil, filesystem.NewMemory("/Users/test"), kubeconfig.KubeConfig{}, nil)
+		assert.Nil(t, cfg.SetOutput(kubetmuxp.Output{TmuxpDir: "/Users/test/.tmuxp"}))
+
+		sessions, err := cfg.Sessions()
+
+		assert.Nil(t, err)
+		assert.Empty(t, sessions)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Run("should restore the latest backup and forget the hash of the context", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.AddFile("/Users/test/.kube/configs/test-ctx", []byte("broken"), 0600))
+		assert.Nil(t, fs.AddFile("/Users/test/.kube/configs/.test-ctx.hash", []byte("hash\n"), 0600))
+		assert.Nil(t, fs.AddFile("/Users/test/.kube/configs/.backups/test-ctx.20200101T000000.000000000Z", []byte("old"), 0644))
+		assert.Nil(t, fs.AddFile("/Users/test/.kube/configs/.backups/test-ctx.20200102T000000.000000000Z", []byte("previous"), 0644))
+		kubeCfg, _ := kubeconfig.New(fs, mock.NewCommander(ctrl))
+		cfg, _ := kubetmuxp.NewConfigWithProjects(nil, fs, kubeCfg, nil)
+
+		backup, err := cfg.Restore("test-ctx")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/Users/test/.kube/configs/.backups/test-ctx.20200102T000000.000000000Z", backup)
+		assert.Equal(t, "previous", readFile(t, fs, "/Users/test/.kube/configs/test-ctx"))
+		assert.Equal(t, []string{".backups", "test-ctx"}, fileNames(t, fs, "/Users/test/.kube/configs"))
+		assert.Len(t, fileNames(t, fs, "/Users/test/.kube/configs/.backups"), 2)
+	})
+
+	t.Run("should return error if the context has no backups", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		kubeCfg, _ := kubeconfig.New(fs, mock.NewCommander(ctrl))
+		cfg, _ := kubetmuxp.NewConfigWithProjects(nil, fs, kubeCfg, nil)
+
+		_, err := cfg.Restore("test-ctx")
+
+		assert.EqualError(t, err, "no backups found for context test-ctx")
+	})
+}
+
+func TestDiff(t *testing.T) {
+	old := kubetmuxp.Projects{
+		{
+			Name: "test-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "unchanged", Zone: "test-zone", Context: "unchanged-ctx"},
+				{Name: "changed", Zone: "test-zone", Context: "changed-ctx", Envs: kubetmuxp.Envs{"KEY": "old"}},
+				{Name: "removed", Zone: "test-zone", Context: "removed-ctx"},
+			},
+		},
+		{
+			Name: "moved-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "moved", Region: "test-region", Context: "moved-ctx"},
+			},
+		},
+	}
+	new := kubetmuxp.Projects{
+		{
+			Name: "test-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "unchanged", Zone: "test-zone", Context: "unchanged-ctx"},
+				{Name: "changed", Zone: "test-zone", Context: "changed-ctx", Envs: kubetmuxp.Envs{"KEY": "new"}},
+				{Name: "added", Zone: "test-zone", Context: "added-ctx"},
+				{Name: "moved", Region: "test-region", Context: "moved-ctx"},
+			},
+		},
+	}
+
+	t.Run("should report added, changed and removed contexts", func(t *testing.T) {
+		changes := kubetmuxp.Diff(old, new)
+
+		assert.Equal(t, kubetmuxp.Changes{
+			Added:   []string{"added-ctx"},
+			Changed: []string{"changed-ctx", "moved-ctx"},
+			Removed: []string{"removed-ctx"},
+		}, changes)
+		assert.False(t, changes.Empty())
+		assert.Equal(t, "+ added-ctx\n~ changed-ctx\n~ moved-ctx\n- removed-ctx", changes.String())
+	})
+
+	t.Run("should report the clusters whose impersonated service account changed", func(t *testing.T) {
+		impersonating := kubetmuxp.Projects{{Name: "test-project", ImpersonateServiceAccount: "admin@test-project.iam.gserviceaccount.com", Clusters: old[0].Clusters}}
+
+		changes := kubetmuxp.Diff(old[:1], impersonating)
+
+		assert.Equal(t, []string{"unchanged-ctx", "changed-ctx", "removed-ctx"}, changes.Changed)
+	})
+
+	t.Run("should report no changes for identical configs", func(t *testing.T) {
+		changes := kubetmuxp.Diff(old, old)
+
+		assert.True(t, changes.Empty())
+		assert.Equal(t, "", changes.String())
+	})
+}
+
+func TestProcess(t *testing.T) {
+	projects := kubetmuxp.Projects{
+		{
+			Name: "test-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "test-cluster", Zone: "test-zone", Context: "test-ctx", Envs: kubetmuxp.Envs{"TEST_ENV": "new-value"}},
+			},
+		},
+	}
+	expectFetch := func(mockCmdr *mock.Commander, endpoint string) {
+		expectClusters(mockCmdr, "test-project", fmt.Sprintf(`[{"name": "test-cluster", "location": "test-zone", "endpoint": %q}]`, endpoint))
+	}
+
+	t.Run("should fetch kubeconfig and store the hash of the cluster definition", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		expectFetch(mockCmdr, "10.0.0.1")
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.kube/configs/test-ctx"), "server: https://10.0.0.1\n")
+		assert.Regexp(t, "^[0-9a-f]{64}\n$", readFile(t, fs, "/Users/test/.kube/configs/.test-ctx.hash"))
+		assert.Equal(t, `session_name: test-ctx
+windows:
+- window_name: default
+  panes: []
+environment:
+  KUBECONFIG: /Users/test/.kube/configs/test-ctx
+  TEST_ENV: new-value
+`, readFile(t, fs, "/Users/test/.tmuxp/test-ctx.yaml"))
+	})
+
+	t.Run("should fetch kubeconfig with the account and configuration of the project", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json", "--account=test@example.com"}, []string{"CLOUDSDK_ACTIVE_CONFIG_NAME=work"}).Return(`[{"name": "test-cluster", "location": "test-zone", "endpoint": "10.0.0.1"}]`, nil)
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		withIdentity := kubetmuxp.Projects{{Name: "test-project", Account: "test@example.com", GCloudConfiguration: "work", Clusters: projects[0].Clusters}}
+		cfg, _ := kubetmuxp.NewConfigWithProjects(withIdentity, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.kube/configs/test-ctx"), `      env:
+      - name: CLOUDSDK_ACTIVE_CONFIG_NAME
+        value: work
+      - name: CLOUDSDK_CORE_ACCOUNT
+        value: test@example.com
+`)
+	})
+
+	t.Run("should fetch kubeconfig impersonating the service account of the cluster", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", []string{"container", "clusters", "list", "--project", "test-project", "--format=json", "--impersonate-service-account=admin@test-project.iam.gserviceaccount.com"}, nil).Return(`[{"name": "test-cluster", "location": "test-zone", "endpoint": "10.0.0.1"}]`, nil)
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		impersonating := kubetmuxp.Projects{{
+			Name:                      "test-project",
+			ImpersonateServiceAccount: "viewer@test-project.iam.gserviceaccount.com",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "test-cluster", Zone: "test-zone", Context: "test-ctx", ImpersonateServiceAccount: "admin@test-project.iam.gserviceaccount.com"},
+			},
+		}}
+		cfg, _ := kubetmuxp.NewConfigWithProjects(impersonating, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.kube/configs/test-ctx"), `      env:
+      - name: CLOUDSDK_AUTH_IMPERSONATE_SERVICE_ACCOUNT
+        value: admin@test-project.iam.gserviceaccount.com
+`)
+		assert.Equal(t, `session_name: test-ctx
+windows:
+- window_name: default
+  panes: []
+environment:
+  KUBECONFIG: /Users/test/.kube/configs/test-ctx
+  KUBETMUXP_IMPERSONATED_SERVICE_ACCOUNT: admin@test-project.iam.gserviceaccount.com
+  KUBETMUXP_PROMPT_HINT: as admin@test-project.iam.gserviceaccount.com
+`, readFile(t, fs, "/Users/test/.tmuxp/test-ctx.yaml"))
+	})
+
+	t.Run("should fetch kubeconfig with the internal endpoint reached through the proxy of the cluster", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		expectClusters(mockCmdr, "test-project", `[{"name": "test-cluster", "location": "test-zone", "endpoint": "34.0.0.1", "privateClusterConfig": {"privateEndpoint": "10.0.0.1"}}]`)
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		private := kubetmuxp.Projects{{
+			Name: "test-project",
+			Clusters: kubetmuxp.Clusters{
+				{Name: "test-cluster", Zone: "test-zone", Context: "test-ctx", Endpoint: kubetmuxp.InternalEndpoint, ProxyURL: "http://bastion:8888"},
+			},
+		}}
+		cfg, _ := kubetmuxp.NewConfigWithProjects(private, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.kube/configs/test-ctx"), "    server: https://10.0.0.1\n    proxy-url: http://bastion:8888\n")
+	})
+
+	t.Run("should skip fetching kubeconfig of unchanged clusters but rewrite tmuxp config", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		mockCmdr := mock.NewCommander(ctrl)
+		expectFetch(mockCmdr, "10.0.0.1")
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+		assert.Nil(t, cfg.Process(context.Background(), true))
+		assert.Nil(t, fs.Remove("/Users/test/.tmuxp/test-ctx.yaml"))
+
+		err := cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.tmuxp/test-ctx.yaml"), "TEST_ENV: new-value")
+		assert.Equal(t, []string{".test-ctx.hash", "test-ctx"}, fileNames(t, fs, "/Users/test/.kube/configs"))
+	})
+
+	t.Run("should fetch kubeconfig again and back up the previous one if the cluster definition changed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.AddFile("/Users/test/.kube/configs/test-ctx", []byte("old-kubeconfig"), 0600))
+		assert.Nil(t, fs.AddFile("/Users/test/.kube/configs/.test-ctx.hash", []byte("stale-hash\n"), 0600))
+		mockCmdr := mock.NewCommander(ctrl)
+		expectFetch(mockCmdr, "10.0.0.2")
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		cfg, _ := kubetmuxp.NewConfigWithProjects(projects, fs, kubeCfg, nil)
+		lookUpClusters(&cfg)
+
+		err := cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.kube/configs/test-ctx"), "server: https://10.0.0.2\n")
+		backups, _ := kubeCfg.Backups("test-ctx")
+		assert.Len(t, backups, 1)
+		assert.Equal(t, "old-kubeconfig", readFile(t, fs, backups[0]))
+	})
+
+	t.Run("should retry transient failures with the retry policy of the config", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		fs := filesystem.NewMemory("/Users/test")
+		assert.Nil(t, fs.AddFile("/Users/test/kube-tmuxp-config.yaml", []byte(`retry:
+  initialBackoff: 1ms
+  jitter: 0
+projects:
+- name: test-project
+  clusters:
+  - name: test-cluster
+    zone: test-zone
+    context: test-ctx
+`), 0644))
+		mockCmdr := mock.NewCommander(ctrl)
+		mockCmdr.EXPECT().Execute(gomock.Any(), "gcloud", gomock.Any(), gomock.Any()).Return("", &commander.Error{Command: "gcloud", ExitCode: 1, Stderr: "ERROR: Quota exceeded"})
+		expectFetch(mockCmdr, "10.0.0.1")
+		kubeCfg, _ := kubeconfig.New(fs, mockCmdr)
+		var log bytes.Buffer
+		cfg, err := kubetmuxp.NewConfig("/Users/test/kube-tmuxp-config.yaml", fs, kubeCfg, logging.New(&log, logging.InfoLevel, logging.TextFormat))
+		assert.Nil(t, err)
+		lookUpClusters(&cfg)
+
+		err = cfg.Process(context.Background(), false)
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, fs, "/Users/test/.kube/configs/test-ctx"), "server: https://10.0.0.1\n")
+		assert.Equal(t, 1, cfg.KubeConfig().Commander().(*commander.Retrying).Retries())
+		assert.Regexp(t, `^warning: Retrying command backoff=1ms attempt=2 maxAttempts=3 error="gcloud exited with code 1: ERROR: Quota exceeded"
+Fetched kubeconfig cluster=test-cluster context=test-ctx file=/Users/test/.kube/configs/test-ctx
+Summary fetched=1 upToDate=0 retried=1
+$`, log.String())
+	})
+}
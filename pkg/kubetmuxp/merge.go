@@ -0,0 +1,167 @@
+package kubetmuxp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	yamlV3 "gopkg.in/yaml.v3"
+)
+
+// MissingComment flags the clusters of a config
+// that were not found when discovering them again
+const MissingComment = "# kube-tmuxp: not found by the last discovery"
+
+// MergeResult tells which clusters merging discovered projects into
+// a config added and flagged, as project/name
+type MergeResult struct {
+	Added   []string
+	Missing []string
+}
+
+// Merge adds the discovered projects and clusters missing from the config
+// data, keeping the fields and comments already in it. The clusters of the
+// discovered projects for which exists returns false are flagged with
+// MissingComment, which is removed once they exist again.
+func Merge(data []byte, discovered Projects, exists func(project string, cluster Cluster) bool) ([]byte, MergeResult, error) {
+	result := MergeResult{}
+	var doc yamlV3.Node
+	if err := yamlV3.Unmarshal(data, &doc); err != nil {
+		return nil, result, err
+	}
+	if doc.Kind == 0 {
+		// an empty config can still have comments, which yaml drops
+		doc = yamlV3.Node{Kind: yamlV3.DocumentNode, HeadComment: comments(data), Content: []*yamlV3.Node{{Kind: yamlV3.MappingNode, Tag: "!!map"}}}
+	}
+	projectsNode, err := sequence(doc.Content[0], "projects")
+	if err != nil {
+		return nil, result, err
+	}
+
+	for _, project := range discovered {
+		projectNode := findProject(projectsNode, project.Name)
+		if projectNode == nil {
+			if err := appendNode(projectsNode, project); err != nil {
+				return nil, result, err
+			}
+			for _, cluster := range project.Clusters {
+				result.Added = append(result.Added, project.Name+"/"+cluster.Name)
+			}
+			continue
+		}
+
+		clustersNode, err := sequence(projectNode, "clusters")
+		if err != nil {
+			return nil, result, fmt.Errorf("invalid project %s: %v", project.Name, err)
+		}
+		existing := len(clustersNode.Content)
+		for _, cluster := range project.Clusters {
+			if findCluster(clustersNode.Content[:existing], cluster) != nil {
+				continue
+			}
+			if err := appendNode(clustersNode, cluster); err != nil {
+				return nil, result, err
+			}
+			result.Added = append(result.Added, project.Name+"/"+cluster.Name)
+		}
+		for _, clusterNode := range clustersNode.Content[:existing] {
+			var cluster Cluster
+			if err := clusterNode.Decode(&cluster); err != nil {
+				return nil, result, fmt.Errorf("invalid cluster in project %s: %v", project.Name, err)
+			}
+			if exists(project.Name, cluster) {
+				clusterNode.HeadComment = withoutMissingComment(clusterNode.HeadComment)
+				continue
+			}
+			result.Missing = append(result.Missing, project.Name+"/"+cluster.Name)
+			if !strings.Contains(clusterNode.HeadComment, MissingComment) {
+				clusterNode.HeadComment = strings.TrimPrefix(clusterNode.HeadComment+"\n"+MissingComment, "\n")
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yamlV3.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, result, err
+	}
+	return out.Bytes(), result, encoder.Close()
+}
+
+// sequence returns the sequence that is the value of the key in the
+// mapping, adding an empty one when the key is missing or has no value
+func sequence(mapping *yamlV3.Node, key string) (*yamlV3.Node, error) {
+	if mapping.Kind != yamlV3.MappingNode {
+		return nil, fmt.Errorf("expected a mapping at line %d", mapping.Line)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		value := mapping.Content[i+1]
+		if value.Kind == yamlV3.ScalarNode && value.Tag == "!!null" {
+			value.Kind, value.Tag, value.Value = yamlV3.SequenceNode, "!!seq", ""
+		}
+		if value.Kind != yamlV3.SequenceNode {
+			return nil, fmt.Errorf("expected %s to be a list at line %d", key, value.Line)
+		}
+		return value, nil
+	}
+	value := &yamlV3.Node{Kind: yamlV3.SequenceNode, Tag: "!!seq"}
+	mapping.Content = append(mapping.Content, &yamlV3.Node{Kind: yamlV3.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value, nil
+}
+
+func findProject(projects *yamlV3.Node, name string) *yamlV3.Node {
+	for _, node := range projects.Content {
+		var project struct {
+			Name string `yaml:"name"`
+		}
+		if node.Decode(&project) == nil && project.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// findCluster returns the node of the cluster with the same name and location
+func findCluster(clusters []*yamlV3.Node, cluster Cluster) *yamlV3.Node {
+	for _, node := range clusters {
+		var existing Cluster
+		if node.Decode(&existing) == nil && existing.Name == cluster.Name && existing.Zone == cluster.Zone && existing.Region == cluster.Region {
+			return node
+		}
+	}
+	return nil
+}
+
+func appendNode(seq *yamlV3.Node, value interface{}) error {
+	var node yamlV3.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	seq.Content = append(seq.Content, &node)
+	return nil
+}
+
+func withoutMissingComment(comment string) string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		if line != MissingComment {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// comments returns the comment lines of the data, with the blank lines between them
+func comments(data []byte) string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
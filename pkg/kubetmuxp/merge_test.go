@@ -0,0 +1,117 @@
+package kubetmuxp_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubetmuxp"
+)
+
+const handEditedConfig = `# clusters of the team
+kubeconfigDir: ~/.kube/configs # kept apart
+projects:
+- name: test-project
+  clusters:
+  # the main one
+  - name: test-cluster
+    zone: test-zone
+    context: main
+    envs:
+      TEAM: payments
+  - name: removed-cluster
+    region: test-region
+    context: removed-cluster
+`
+
+func TestMerge(t *testing.T) {
+	discovered := kubetmuxp.Projects{
+		{Name: "test-project", Clusters: kubetmuxp.Clusters{
+			{Name: "test-cluster", Zone: "test-zone", Context: "test-cluster"},
+			{Name: "new-cluster", Region: "test-region", Context: "new-cluster", Envs: kubetmuxp.Envs{"GCP_PROJECT_ID": "test-project"}},
+		}},
+		{Name: "new-project", Clusters: kubetmuxp.Clusters{{Name: "another-cluster", Zone: "test-zone", Context: "another-cluster"}}},
+	}
+	listed := func(project string, cluster kubetmuxp.Cluster) bool {
+		return cluster.Name != "removed-cluster"
+	}
+
+	t.Run("should add the new clusters and flag the missing ones keeping the rest of the config", func(t *testing.T) {
+		merged, result, err := kubetmuxp.Merge([]byte(handEditedConfig), discovered, listed)
+
+		assert.Nil(t, err)
+		assert.Equal(t, kubetmuxp.MergeResult{
+			Added:   []string{"test-project/new-cluster", "new-project/another-cluster"},
+			Missing: []string{"test-project/removed-cluster"},
+		}, result)
+		assert.Equal(t, `# clusters of the team
+kubeconfigDir: ~/.kube/configs # kept apart
+projects:
+  - name: test-project
+    clusters:
+      # the main one
+      - name: test-cluster
+        zone: test-zone
+        context: main
+        envs:
+          TEAM: payments
+      # kube-tmuxp: not found by the last discovery
+      - name: removed-cluster
+        region: test-region
+        context: removed-cluster
+      - name: new-cluster
+        region: test-region
+        context: new-cluster
+        envs:
+          GCP_PROJECT_ID: test-project
+  - name: new-project
+    clusters:
+      - name: another-cluster
+        zone: test-zone
+        context: another-cluster
+`, string(merged))
+	})
+
+	t.Run("should not change the config when merging the same clusters again", func(t *testing.T) {
+		merged, _, err := kubetmuxp.Merge([]byte(handEditedConfig), discovered, listed)
+		assert.Nil(t, err)
+
+		remerged, result, err := kubetmuxp.Merge(merged, discovered, listed)
+
+		assert.Nil(t, err)
+		assert.Empty(t, result.Added)
+		assert.Equal(t, string(merged), string(remerged))
+	})
+
+	t.Run("should remove the flag of the clusters found again", func(t *testing.T) {
+		merged, _, err := kubetmuxp.Merge([]byte(handEditedConfig), discovered, listed)
+		assert.Nil(t, err)
+
+		remerged, result, err := kubetmuxp.Merge(merged, discovered, func(string, kubetmuxp.Cluster) bool { return true })
+
+		assert.Nil(t, err)
+		assert.Empty(t, result.Missing)
+		assert.NotContains(t, string(remerged), kubetmuxp.MissingComment)
+		assert.Contains(t, string(remerged), "# the main one\n")
+	})
+
+	t.Run("should create the config when there is none", func(t *testing.T) {
+		merged, result, err := kubetmuxp.Merge(nil, discovered[1:], listed)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"new-project/another-cluster"}, result.Added)
+		assert.Equal(t, "projects:\n  - name: new-project\n    clusters:\n      - name: another-cluster\n        zone: test-zone\n        context: another-cluster\n", string(merged))
+	})
+
+	t.Run("should keep the comments of a config without anything else", func(t *testing.T) {
+		merged, _, err := kubetmuxp.Merge([]byte("# clusters of the team\n\n# generated by kube-tmuxp\n"), discovered[1:], listed)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "# clusters of the team\n\n# generated by kube-tmuxp\n\nprojects:\n  - name: new-project\n    clusters:\n      - name: another-cluster\n        zone: test-zone\n        context: another-cluster\n", string(merged))
+	})
+
+	t.Run("should return error when projects is not a list", func(t *testing.T) {
+		_, _, err := kubetmuxp.Merge([]byte("projects: some-project\n"), discovered, listed)
+
+		assert.EqualError(t, err, "expected projects to be a list at line 1")
+	})
+}
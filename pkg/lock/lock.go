@@ -0,0 +1,73 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var pollInterval = 100 * time.Millisecond
+
+// Lock is an advisory lock held on a file
+type Lock struct {
+	file *os.File
+	path string
+}
+
+// BusyError is returned when the lock is held by another process
+type BusyError struct {
+	PID int
+}
+
+func (e *BusyError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("another kube-tmuxp is running (pid %d)", e.PID)
+	}
+	return "another kube-tmuxp is running"
+}
+
+// Acquire takes the lock on the given file and records the pid of the
+// current process in it. If another process holds the lock, Acquire
+// waits for it to be released when wait is true, until ctx is done,
+// and returns a BusyError otherwise. A lock file left behind by a
+// process that is no longer running is taken over. The directory of
+// the lock file should exist.
+func Acquire(ctx context.Context, file string, wait bool) (*Lock, error) {
+	for {
+		l, err := tryAcquire(file)
+		if _, busy := err.(*BusyError); !busy || !wait {
+			return l, err
+		}
+		timer := time.NewTimer(pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d\n", os.Getpid()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func parsePID(data []byte) int {
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
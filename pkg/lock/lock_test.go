@@ -0,0 +1,116 @@
+package lock_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/lock"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kube-tmuxp-lock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("should record the pid of the holder in the lock file", func(t *testing.T) {
+		file := path.Join(dir, "pid.lock")
+
+		l, err := lock.Acquire(context.Background(), file, false)
+
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadFile(file)
+		assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+		assert.Nil(t, l.Release())
+	})
+
+	t.Run("should fail if the lock is held", func(t *testing.T) {
+		file := path.Join(dir, "held.lock")
+		l, _ := lock.Acquire(context.Background(), file, false)
+		defer l.Release()
+
+		_, err := lock.Acquire(context.Background(), file, false)
+
+		assert.EqualError(t, err, fmt.Sprintf("another kube-tmuxp is running (pid %d)", os.Getpid()))
+	})
+
+	t.Run("should acquire the lock again after it is released", func(t *testing.T) {
+		file := path.Join(dir, "released.lock")
+		l, _ := lock.Acquire(context.Background(), file, false)
+		assert.Nil(t, l.Release())
+
+		l, err := lock.Acquire(context.Background(), file, false)
+
+		assert.Nil(t, err)
+		assert.Nil(t, l.Release())
+	})
+
+	t.Run("should take over a stale lock file", func(t *testing.T) {
+		file := path.Join(dir, "stale.lock")
+		assert.Nil(t, ioutil.WriteFile(file, []byte(fmt.Sprintf("%d\n", math.MaxInt32)), 0644))
+
+		l, err := lock.Acquire(context.Background(), file, false)
+
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadFile(file)
+		assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+		assert.Nil(t, l.Release())
+	})
+
+	t.Run("should leave the directory of the lock file as it is", func(t *testing.T) {
+		lockDir := path.Join(dir, "existing")
+		assert.Nil(t, os.Mkdir(lockDir, 0755))
+
+		l, err := lock.Acquire(context.Background(), path.Join(lockDir, "test.lock"), false)
+		assert.Nil(t, err)
+		assert.Nil(t, l.Release())
+
+		info, err := os.Stat(lockDir)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+		_, err = lock.Acquire(context.Background(), path.Join(dir, "missing", "test.lock"), false)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("should wait for the lock to be released", func(t *testing.T) {
+		file := path.Join(dir, "wait.lock")
+		held, _ := lock.Acquire(context.Background(), file, false)
+		released := make(chan struct{})
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			_ = held.Release()
+			close(released)
+		}()
+
+		l, err := lock.Acquire(context.Background(), file, true)
+
+		assert.Nil(t, err)
+		select {
+		case <-released:
+		default:
+			t.Fatal("lock was acquired before it was released")
+		}
+		assert.Nil(t, l.Release())
+	})
+
+	t.Run("should stop waiting for the lock when the context is done", func(t *testing.T) {
+		file := path.Join(dir, "cancel.lock")
+		held, _ := lock.Acquire(context.Background(), file, false)
+		defer held.Release()
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err := lock.Acquire(ctx, file, true)
+
+		assert.Equal(t, context.Canceled, err)
+	})
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// tryAcquire takes a flock on the file. The kernel releases it when the
+// holding process exits, so a lock file whose process has died is never
+// locked and its stale pid is simply overwritten.
+func tryAcquire(file string) (*Lock, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		data, _ := ioutil.ReadAll(f)
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, &BusyError{PID: parsePID(data)}
+		}
+		return nil, err
+	}
+
+	if err := writePID(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Lock{file: f, path: file}, nil
+}
+
+// Release releases the lock. The lock file is left in place so that
+// processes waiting on it keep locking the same file.
+func (l *Lock) Release() error {
+	_ = l.file.Truncate(0)
+	defer l.file.Close()
+	return syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+}
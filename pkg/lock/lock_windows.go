@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package lock
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// tryAcquire creates the lock file exclusively. A lock file whose
+// process is no longer running is stale and gets replaced.
+func tryAcquire(file string) (*Lock, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			if err := writePID(f); err != nil {
+				_ = f.Close()
+				_ = os.Remove(file)
+				return nil, err
+			}
+			return &Lock{file: f, path: file}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if pid := parsePID(data); err == nil && processExists(pid) {
+			return nil, &BusyError{PID: pid}
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, &BusyError{}
+}
+
+// Release releases the lock by removing the lock file
+func (l *Lock) Release() error {
+	_ = l.file.Close()
+	return os.Remove(l.path)
+}
+
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
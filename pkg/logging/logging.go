@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// Levels of log entries, from the most to the least verbose
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// String returns the name of the level
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warning"
+	case ErrorLevel:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// Format is the encoding of log entries
+type Format string
+
+// Formats of log entries
+const (
+	// TextFormat writes the message followed by key=value pairs,
+	// prefixed with the level unless it is info
+	TextFormat Format = "text"
+	// JSONFormat writes one JSON object per entry
+	JSONFormat Format = "json"
+)
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case TextFormat, JSONFormat:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid log format: valid formats are text,json")
+	}
+}
+
+// Logger writes structured log entries of at least its level.
+// A nil Logger discards everything, so that it is optional.
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	format Format
+	fields []interface{}
+	stamp  bool
+	now    func() time.Time
+}
+
+// New returns a Logger writing entries of at least the given level to out
+func New(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{mu: &sync.Mutex{}, out: out, level: level, format: format, now: time.Now}
+}
+
+// With returns a Logger that adds the given key value pairs to each entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &child
+}
+
+// Timestamped returns a Logger that starts text entries with the
+// time they were written at, as JSON entries always have it
+func (l *Logger) Timestamped() *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.stamp = true
+	return &child
+}
+
+// Enabled tells if entries of the given level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+// Debug logs the message with the key value pairs at debug level
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(DebugLevel, msg, keyvals)
+}
+
+// Info logs the message with the key value pairs at info level
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(InfoLevel, msg, keyvals)
+}
+
+// Warn logs the message with the key value pairs at warning level
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(WarnLevel, msg, keyvals)
+}
+
+// Error logs the message with the key value pairs at error level
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(ErrorLevel, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	keyvals = append(append([]interface{}{}, l.fields...), keyvals...)
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(missing)")
+	}
+
+	var entry bytes.Buffer
+	if l.format == JSONFormat {
+		writeJSON(&entry, l.now(), level, msg, keyvals)
+	} else {
+		if l.stamp {
+			entry.WriteString(l.now().Format(time.RFC3339) + " ")
+		}
+		writeText(&entry, level, msg, keyvals)
+	}
+	entry.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(entry.Bytes())
+}
+
+func writeText(entry *bytes.Buffer, level Level, msg string, keyvals []interface{}) {
+	if level != InfoLevel {
+		entry.WriteString(level.String() + ": ")
+	}
+	entry.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		text := fmt.Sprint(value(keyvals[i+1]))
+		if text == "" || strings.ContainsAny(text, " =\"\t\n") {
+			text = strconv.Quote(text)
+		}
+		_, _ = fmt.Fprintf(entry, " %v=%s", keyvals[i], text)
+	}
+}
+
+func writeJSON(entry *bytes.Buffer, now time.Time, level Level, msg string, keyvals []interface{}) {
+	entry.WriteString(`{"time":`)
+	writeJSONValue(entry, now.Format(time.RFC3339Nano))
+	entry.WriteString(`,"level":`)
+	writeJSONValue(entry, level.String())
+	entry.WriteString(`,"msg":`)
+	writeJSONValue(entry, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		entry.WriteByte(',')
+		writeJSONValue(entry, fmt.Sprint(keyvals[i]))
+		entry.WriteByte(':')
+		writeJSONValue(entry, value(keyvals[i+1]))
+	}
+	entry.WriteByte('}')
+}
+
+func writeJSONValue(entry *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	entry.Write(data)
+}
+
+// value returns what is logged for v: the message of
+// errors and the string form of durations and Stringers
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
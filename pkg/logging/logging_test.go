@@ -0,0 +1,88 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+)
+
+func TestLogger(t *testing.T) {
+	t.Run("should write entries of at least the level of the logger", func(t *testing.T) {
+		var out bytes.Buffer
+		log := logging.New(&out, logging.WarnLevel, logging.TextFormat)
+
+		log.Debug("debug message")
+		log.Info("info message")
+		log.Warn("warn message")
+		log.Error("error message")
+
+		assert.Equal(t, "warning: warn message\nerror: error message\n", out.String())
+		assert.False(t, log.Enabled(logging.InfoLevel))
+		assert.True(t, log.Enabled(logging.ErrorLevel))
+	})
+
+	t.Run("should write the key value pairs in text format", func(t *testing.T) {
+		var out bytes.Buffer
+		log := logging.New(&out, logging.DebugLevel, logging.TextFormat)
+
+		log.With("cluster", "test-cluster").Debug("Fetched", "took", 1500*time.Millisecond, "error", fmt.Errorf("some error"), "empty", "", "odd")
+
+		assert.Equal(t, "debug: Fetched cluster=test-cluster took=1.5s error=\"some error\" empty=\"\" odd=(missing)\n", out.String())
+	})
+
+	t.Run("should write one JSON object per entry in json format", func(t *testing.T) {
+		var out bytes.Buffer
+		log := logging.New(&out, logging.InfoLevel, logging.JSONFormat)
+
+		log.With("cluster", "test-cluster").Info("Fetched", "contexts", []string{"a", "b"}, "took", time.Second)
+		log.Error("Failed", "error", fmt.Errorf("some \"error\""))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(t, lines, 2)
+		var entry map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(lines[0]), &entry))
+		_, err := time.Parse(time.RFC3339Nano, entry["time"].(string))
+		assert.Nil(t, err)
+		delete(entry, "time")
+		assert.Equal(t, map[string]interface{}{"level": "info", "msg": "Fetched", "cluster": "test-cluster", "contexts": []interface{}{"a", "b"}, "took": "1s"}, entry)
+		assert.Regexp(t, `^\{"time":"[^"]+","level":"error","msg":"Failed","error":"some \\"error\\""\}$`, lines[1])
+	})
+
+	t.Run("should start text entries with the time when timestamped", func(t *testing.T) {
+		var out bytes.Buffer
+		log := logging.New(&out, logging.InfoLevel, logging.TextFormat).Timestamped()
+
+		log.Info("message")
+
+		assert.Regexp(t, `^\d{4}-\d\d-\d\dT\S+ message\n$`, out.String())
+	})
+
+	t.Run("should discard everything when nil", func(t *testing.T) {
+		var log *logging.Logger
+
+		log.With("key", "value").Error("message")
+
+		assert.False(t, log.Enabled(logging.ErrorLevel))
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Run("should parse the supported formats", func(t *testing.T) {
+		format, err := logging.ParseFormat("json")
+
+		assert.Nil(t, err)
+		assert.Equal(t, logging.JSONFormat, format)
+	})
+
+	t.Run("should return error for unknown formats", func(t *testing.T) {
+		_, err := logging.ParseFormat("xml")
+
+		assert.EqualError(t, err, "invalid log format: valid formats are text,json")
+	})
+}
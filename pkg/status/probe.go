@@ -0,0 +1,109 @@
+package status
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+)
+
+// Probe represents the result of probing an API server
+type Probe struct {
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ProbeServer checks whether the API server of the cluster
+// answers /version within the given timeout
+func ProbeServer(ctx context.Context, cluster kubeconfig.Cluster, user kubeconfig.User, timeout time.Duration) Probe {
+	client, err := newHTTPClient(cluster, user)
+	if err != nil {
+		return Probe{Error: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(cluster.Server, "/")+"/version", nil)
+	if err != nil {
+		return Probe{Error: err.Error()}
+	}
+	req = req.WithContext(ctx)
+	if token := user.BearerToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return Probe{LatencyMs: latency, Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	probe := Probe{Reachable: true, LatencyMs: latency}
+	if resp.StatusCode != http.StatusOK {
+		probe.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+		return probe
+	}
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		probe.Error = fmt.Sprintf("error decoding version: %v", err)
+		return probe
+	}
+	probe.Version = version.GitVersion
+	return probe
+}
+
+func newHTTPClient(cluster kubeconfig.Cluster, user kubeconfig.User) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster.InsecureSkipTLSVerify}
+	if cluster.CertificateAuthorityData != "" {
+		ca, err := base64.StdEncoding.DecodeString(cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding certificate authority: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("error parsing certificate authority: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if user.ClientCertificateData != "" && user.ClientKeyData != "" {
+		cert, err := base64.StdEncoding.DecodeString(user.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding client certificate: %v", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(user.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding client key: %v", err)
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cluster.ProxyURL != "" {
+		proxyURL, err := url.Parse(cluster.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing proxy url: %v", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: &http.Transport{Proxy: proxy, TLSClientConfig: tlsConfig}}, nil
+}
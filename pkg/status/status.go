@@ -0,0 +1,242 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+)
+
+// State represents the health of a credential
+type State string
+
+// Possible states of a credential
+const (
+	Valid    State = "valid"
+	Expiring State = "expiring"
+	Expired  State = "expired"
+	// Unknown is used when the expiry of a credential
+	// cannot be determined, e.g. exec plugins
+	Unknown State = "unknown"
+)
+
+// Credential represents the status of a credential in a kubeconfig
+type Credential struct {
+	Kind   string     `json:"kind"`
+	State  State      `json:"state"`
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+// Context represents the status of a generated kubeconfig
+type Context struct {
+	Name        string       `json:"context"`
+	KubeConfig  string       `json:"kubeconfig"`
+	Exists      bool         `json:"exists"`
+	Error       string       `json:"error,omitempty"`
+	Credentials []Credential `json:"credentials,omitempty"`
+	Probe       *Probe       `json:"probe,omitempty"`
+}
+
+// Healthy tells if the kubeconfig exists, none of its
+// credentials have expired and its API server is reachable
+func (c Context) Healthy() bool {
+	if !c.Exists || c.Error != "" {
+		return false
+	}
+	for _, cred := range c.Credentials {
+		if cred.State == Expired {
+			return false
+		}
+	}
+	return c.Probe == nil || c.Probe.Reachable
+}
+
+// Contexts represents the status of all the generated kubeconfigs
+type Contexts []Context
+
+// Healthy tells if all the contexts are healthy
+func (c Contexts) Healthy() bool {
+	for _, ctx := range c {
+		if !ctx.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteJSON writes the statuses as JSON
+func (c Contexts) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+// WriteText writes the statuses as a table relative to the given time
+func (c Contexts) WriteText(w io.Writer, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	probed := false
+	for _, ctx := range c {
+		probed = probed || ctx.Probe != nil
+	}
+
+	header := "CONTEXT\tKUBECONFIG\tCREDENTIALS"
+	if probed {
+		header += "\tAPI SERVER"
+	}
+	if _, err := fmt.Fprintln(tw, header); err != nil {
+		return err
+	}
+
+	for _, ctx := range c {
+		file := "ok"
+		if !ctx.Exists {
+			file = "missing"
+		} else if ctx.Error != "" {
+			file = ctx.Error
+		}
+
+		creds := make([]string, 0, len(ctx.Credentials))
+		for _, cred := range ctx.Credentials {
+			creds = append(creds, describeCredential(cred, now))
+		}
+		credsText := strings.Join(creds, ", ")
+		if credsText == "" {
+			credsText = "-"
+		}
+
+		row := fmt.Sprintf("%s\t%s\t%s", ctx.Name, file, credsText)
+		if probed {
+			row += "\t" + describeProbe(ctx.Probe)
+		}
+		if _, err := fmt.Fprintln(tw, row); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func describeCredential(cred Credential, now time.Time) string {
+	switch cred.State {
+	case Expired:
+		return fmt.Sprintf("%s expired %s ago", cred.Kind, cred.Expiry.Sub(now).Round(time.Minute)*-1)
+	case Valid, Expiring:
+		if cred.Expiry == nil {
+			return fmt.Sprintf("%s %s", cred.Kind, cred.State)
+		}
+		return fmt.Sprintf("%s %s, expires in %s", cred.Kind, cred.State, cred.Expiry.Sub(now).Round(time.Minute))
+	default:
+		return fmt.Sprintf("%s refreshed on use", cred.Kind)
+	}
+}
+
+func describeProbe(probe *Probe) string {
+	if probe == nil {
+		return "-"
+	}
+	if !probe.Reachable {
+		return fmt.Sprintf("unreachable: %s", probe.Error)
+	}
+	if probe.Error != "" {
+		return fmt.Sprintf("%s (%dms)", probe.Error, probe.LatencyMs)
+	}
+	return fmt.Sprintf("%s (%dms)", probe.Version, probe.LatencyMs)
+}
+
+// Options configures the status checks
+type Options struct {
+	// WarnWithin marks credentials expiring within this duration as expiring
+	WarnWithin time.Duration
+	// Probe enables checking whether the API server is reachable
+	Probe bool
+	// Timeout is the maximum time to wait for the API server
+	Timeout time.Duration
+}
+
+// Checker checks the status of the generated kubeconfigs
+type Checker struct {
+	kubeCfg kubeconfig.KubeConfig
+	options Options
+	now     func() time.Time
+}
+
+// NewChecker returns a new Checker
+func NewChecker(kubeCfg kubeconfig.KubeConfig, options Options) Checker {
+	return Checker{kubeCfg: kubeCfg, options: options, now: time.Now}
+}
+
+// Check checks the status of the kubeconfigs of the given contexts
+func (c Checker) Check(ctx context.Context, contexts []string) Contexts {
+	statuses := make(Contexts, 0, len(contexts))
+	for _, name := range contexts {
+		statuses = append(statuses, c.CheckContext(ctx, name))
+	}
+	return statuses
+}
+
+// CheckContext checks the status of the kubeconfig of the given context
+func (c Checker) CheckContext(ctx context.Context, name string) Context {
+	kubeCfgFile := path.Join(c.kubeCfg.KubeCfgsDir(), name)
+	status := Context{Name: name, KubeConfig: kubeCfgFile}
+
+	file, err := c.kubeCfg.Read(kubeCfgFile)
+	if os.IsNotExist(err) {
+		return status
+	}
+	status.Exists = true
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	cluster, user, err := file.Current()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	creds, err := user.Credentials()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	now := c.now()
+	for _, cred := range creds {
+		status.Credentials = append(status.Credentials, c.evaluate(cred, now))
+	}
+
+	if c.options.Probe {
+		probe := ProbeServer(ctx, cluster, user, c.options.Timeout)
+		status.Probe = &probe
+	}
+	return status
+}
+
+func (c Checker) evaluate(cred kubeconfig.Credential, now time.Time) Credential {
+	result := Credential{Kind: cred.Kind}
+	if cred.Expiry.IsZero() {
+		result.State = Unknown
+		if cred.Kind == "client-certificate" || cred.Kind == "token" {
+			result.State = Valid
+		}
+		return result
+	}
+
+	expiry := cred.Expiry
+	result.Expiry = &expiry
+	switch {
+	case !now.Before(expiry):
+		result.State = Expired
+	case expiry.Sub(now) <= c.options.WarnWithin:
+		result.State = Expiring
+	default:
+		result.State = Valid
+	}
+	return result
+}
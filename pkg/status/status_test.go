@@ -0,0 +1,216 @@
+package status_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/kubeconfig"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/status"
+)
+
+func jwt(expiry time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expiry.Unix())))
+	return fmt.Sprintf("eyJhbGciOiJub25lIn0.%s.signature", payload)
+}
+
+func kubeconfigContent(server, caData string, user string) string {
+	return fmt.Sprintf(`
+current-context: test-ctx
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: test-ctx
+  context:
+    cluster: test-cluster
+    user: test-user
+users:
+- name: test-user
+  user:
+    %s
+`, server, caData, user)
+}
+
+func serverCAData(server *httptest.Server) string {
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+func newKubeCfg(ctrl *gomock.Controller, files map[string]string) kubeconfig.KubeConfig {
+	mockFS := mock.NewFileSystem(ctrl)
+	mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+	mockFS.EXPECT().Open(gomock.Any()).DoAndReturn(func(file string) (*strings.Reader, error) {
+		content, ok := files[file]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: file, Err: os.ErrNotExist}
+		}
+		return strings.NewReader(content), nil
+	}).AnyTimes()
+	kubeCfg, _ := kubeconfig.New(mockFS, mock.NewCommander(ctrl))
+	return kubeCfg
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("should report missing kubeconfigs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		kubeCfg := newKubeCfg(ctrl, map[string]string{})
+
+		statuses := status.NewChecker(kubeCfg, status.Options{}).Check(context.Background(), []string{"test-ctx"})
+
+		assert.Equal(t, status.Contexts{{Name: "test-ctx", KubeConfig: "/Users/test/.kube/configs/test-ctx"}}, statuses)
+		assert.False(t, statuses.Healthy())
+	})
+
+	t.Run("should report the state of credentials", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expiring := time.Now().Add(30 * time.Minute)
+		expired := time.Now().Add(-30 * time.Minute)
+		kubeCfg := newKubeCfg(ctrl, map[string]string{
+			"/Users/test/.kube/configs/expiring": kubeconfigContent("https://10.0.0.1", "", "token: "+jwt(expiring)),
+			"/Users/test/.kube/configs/expired":  kubeconfigContent("https://10.0.0.1", "", "token: "+jwt(expired)),
+			"/Users/test/.kube/configs/exec":     kubeconfigContent("https://10.0.0.1", "", "exec: {command: gke-gcloud-auth-plugin}"),
+		})
+
+		statuses := status.NewChecker(kubeCfg, status.Options{WarnWithin: time.Hour}).Check(context.Background(), []string{"expiring", "expired", "exec"})
+
+		assert.Equal(t, status.Expiring, statuses[0].Credentials[0].State)
+		assert.Equal(t, expiring.Unix(), statuses[0].Credentials[0].Expiry.Unix())
+		assert.True(t, statuses[0].Healthy())
+		assert.Equal(t, status.Expired, statuses[1].Credentials[0].State)
+		assert.False(t, statuses[1].Healthy())
+		assert.Equal(t, []status.Credential{{Kind: "exec:gke-gcloud-auth-plugin", State: status.Unknown}}, statuses[2].Credentials)
+		assert.True(t, statuses[2].Healthy())
+		assert.Nil(t, statuses[2].Probe)
+	})
+
+	t.Run("should report invalid kubeconfigs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		kubeCfg := newKubeCfg(ctrl, map[string]string{"/Users/test/.kube/configs/test-ctx": "current-context: test-ctx"})
+
+		statuses := status.NewChecker(kubeCfg, status.Options{}).Check(context.Background(), []string{"test-ctx"})
+
+		assert.True(t, statuses[0].Exists)
+		assert.Equal(t, "no contexts found", statuses[0].Error)
+		assert.False(t, statuses.Healthy())
+	})
+
+	t.Run("should probe the API server", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/version" || r.Header.Get("Authorization") != "Bearer static-token" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"major":"1","minor":"27","gitVersion":"v1.27.3-gke.100"}`)
+		}))
+		defer server.Close()
+		kubeCfg := newKubeCfg(ctrl, map[string]string{
+			"/Users/test/.kube/configs/test-ctx": kubeconfigContent(server.URL, serverCAData(server), "token: static-token"),
+		})
+
+		statuses := status.NewChecker(kubeCfg, status.Options{Probe: true, Timeout: 5 * time.Second}).Check(context.Background(), []string{"test-ctx"})
+
+		assert.True(t, statuses[0].Probe.Reachable)
+		assert.Equal(t, "v1.27.3-gke.100", statuses[0].Probe.Version)
+		assert.Empty(t, statuses[0].Probe.Error)
+		assert.True(t, statuses.Healthy())
+	})
+}
+
+func TestProbeServer(t *testing.T) {
+	t.Run("should fail if API server does not answer within timeout", func(t *testing.T) {
+		done := make(chan struct{})
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer server.Close()
+		defer close(done)
+
+		probe := status.ProbeServer(context.Background(), kubeconfig.Cluster{Server: server.URL, CertificateAuthorityData: serverCAData(server)}, kubeconfig.User{}, 50*time.Millisecond)
+
+		assert.False(t, probe.Reachable)
+		assert.Contains(t, probe.Error, "context deadline exceeded")
+	})
+
+	t.Run("should fail if API server certificate is not signed by the CA", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+		server.StartTLS()
+		defer server.Close()
+
+		probe := status.ProbeServer(context.Background(), kubeconfig.Cluster{Server: server.URL}, kubeconfig.User{}, time.Second)
+
+		assert.False(t, probe.Reachable)
+		assert.Contains(t, probe.Error, "certificate")
+	})
+
+	t.Run("should report unexpected status codes", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		probe := status.ProbeServer(context.Background(), kubeconfig.Cluster{Server: server.URL, InsecureSkipTLSVerify: true}, kubeconfig.User{}, time.Second)
+
+		assert.True(t, probe.Reachable)
+		assert.Equal(t, "unexpected status 403 Forbidden", probe.Error)
+	})
+
+	t.Run("should reach the API server through the proxy of the cluster", func(t *testing.T) {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host != "cluster.internal" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"gitVersion": "v1.29.1-gke.1"}`))
+		}))
+		defer proxy.Close()
+
+		probe := status.ProbeServer(context.Background(), kubeconfig.Cluster{Server: "http://cluster.internal", ProxyURL: proxy.URL}, kubeconfig.User{}, time.Second)
+
+		assert.True(t, probe.Reachable)
+		assert.Equal(t, "v1.29.1-gke.1", probe.Version)
+	})
+}
+
+func TestWriteText(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	expiry := now.Add(90 * time.Minute)
+	expired := now.Add(-2 * time.Hour)
+	statuses := status.Contexts{
+		{Name: "missing-ctx", KubeConfig: "/Users/test/.kube/configs/missing-ctx"},
+		{Name: "cert-ctx", Exists: true, Credentials: []status.Credential{{Kind: "client-certificate", State: status.Valid, Expiry: &expiry}}, Probe: &status.Probe{Reachable: true, Version: "v1.27.3", LatencyMs: 12}},
+		{Name: "token-ctx", Exists: true, Credentials: []status.Credential{{Kind: "token", State: status.Expired, Expiry: &expired}}, Probe: &status.Probe{Error: "connection refused"}},
+		{Name: "exec-ctx", Exists: true, Credentials: []status.Credential{{Kind: "exec:gke-gcloud-auth-plugin", State: status.Unknown}}},
+	}
+	var out bytes.Buffer
+
+	err := statuses.WriteText(&out, now)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `CONTEXT      KUBECONFIG  CREDENTIALS                                   API SERVER
+missing-ctx  missing     -                                             -
+cert-ctx     ok          client-certificate valid, expires in 1h30m0s  v1.27.3 (12ms)
+token-ctx    ok          token expired 2h0m0s ago                      unreachable: connection refused
+exec-ctx     ok          exec:gke-gcloud-auth-plugin refreshed on use  -
+`, out.String())
+}
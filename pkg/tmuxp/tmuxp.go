@@ -1,6 +1,7 @@
 package tmuxp
 
 import (
+	"os"
 	"path"
 
 	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
@@ -36,32 +37,52 @@ func (c *Config) TmuxpConfigsDir() string {
 
 // Save saves the tmuxp config as file
 func (c *Config) Save(file string) error {
-	writer, err := c.filesystem.Create(file)
+	data, err := yaml.Marshal(c)
 	if err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(c)
+	return filesystem.WriteFile(c.filesystem, file, data)
+}
+
+// DefaultConfigsDir returns the directory in which tmuxp looks
+// for configs: $TMUXP_CONFIGDIR if set, $XDG_CONFIG_HOME/tmuxp
+// if it exists and ~/.tmuxp otherwise
+func DefaultConfigsDir(fs filesystem.FileSystem) (string, error) {
+	if dir := os.Getenv("TMUXP_CONFIGDIR"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := fs.HomeDir()
 	if err != nil {
-		return err
+		return "", err
 	}
-	if _, err := writer.Write(data); err != nil {
-		return err
+
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfigHome == "" {
+		xdgConfigHome = path.Join(home, ".config")
+	}
+	xdgDir := path.Join(xdgConfigHome, "tmuxp")
+	if info, err := fs.Stat(xdgDir); err == nil && info.IsDir() {
+		return xdgDir, nil
 	}
 
-	return nil
+	return path.Join(home, ".tmuxp"), nil
 }
 
-// NewConfig returns a new tmuxp config
+// NewConfig returns a new tmuxp config stored in the default directory
 func NewConfig(sessionName string, windows Windows, environment Environment, fs filesystem.FileSystem) (*Config, error) {
-	home, err := fs.HomeDir()
+	tmuxpCfgsDir, err := DefaultConfigsDir(fs)
 	if err != nil {
 		return nil, err
 	}
-	tmuxpCfgsDir := path.Join(home, ".tmuxp")
 
-	err = fs.CreateDirIfNotExist(tmuxpCfgsDir)
-	if err != nil {
+	return NewConfigInDir(sessionName, windows, environment, fs, tmuxpCfgsDir)
+}
+
+// NewConfigInDir returns a new tmuxp config stored in the given directory
+func NewConfigInDir(sessionName string, windows Windows, environment Environment, fs filesystem.FileSystem, tmuxpCfgsDir string) (*Config, error) {
+	if err := fs.CreateDirIfNotExist(tmuxpCfgsDir); err != nil {
 		return nil, err
 	}
 	return &Config{
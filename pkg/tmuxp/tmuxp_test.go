@@ -3,10 +3,12 @@ package tmuxp_test
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/filesystem"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/internal/mock"
 	"github.com/thecasualcoder/kube-tmuxp/pkg/tmuxp"
 )
@@ -18,6 +20,7 @@ func TestNewConfig(t *testing.T) {
 
 		mockFS := mock.NewFileSystem(ctrl)
 		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
 		mockFS.EXPECT().CreateDirIfNotExist(gomock.Eq("/Users/test/.tmuxp")).Return(nil)
 		tmuxpCfg, err := tmuxp.NewConfig("session", tmuxp.Windows{}, tmuxp.Environment{}, mockFS)
 
@@ -42,6 +45,7 @@ func TestNewConfig(t *testing.T) {
 
 		mockFS := mock.NewFileSystem(ctrl)
 		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
 		mockFS.EXPECT().CreateDirIfNotExist(gomock.Eq("/Users/test/.tmuxp")).Return(fmt.Errorf("error creating .tmuxp dir"))
 		_, err := tmuxp.NewConfig("session", tmuxp.Windows{}, tmuxp.Environment{}, mockFS)
 
@@ -55,27 +59,68 @@ func TestTmuxpConfigsDir(t *testing.T) {
 
 	mockFS := mock.NewFileSystem(ctrl)
 	mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+	mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
 	mockFS.EXPECT().CreateDirIfNotExist(gomock.Eq("/Users/test/.tmuxp")).Return(nil)
 	tmuxpCfg, _ := tmuxp.NewConfig("session", tmuxp.Windows{}, tmuxp.Environment{}, mockFS)
 
 	assert.Equal(t, "/Users/test/.tmuxp", tmuxpCfg.TmuxpConfigsDir())
 }
 
-func TestSave(t *testing.T) {
-	t.Run("should save the tmuxp config as file", func(t *testing.T) {
+type dirInfo struct {
+	os.FileInfo
+}
+
+func (dirInfo) IsDir() bool { return true }
+
+func TestDefaultConfigsDir(t *testing.T) {
+	t.Run("should use TMUXP_CONFIGDIR if it is set", func(t *testing.T) {
+		defer os.Setenv("TMUXP_CONFIGDIR", os.Getenv("TMUXP_CONFIGDIR"))
+		os.Setenv("TMUXP_CONFIGDIR", "/Users/test/tmuxp-configs")
+
+		dir, err := tmuxp.DefaultConfigsDir(nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/Users/test/tmuxp-configs", dir)
+	})
+
+	t.Run("should use tmuxp dir under XDG_CONFIG_HOME if it exists", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
+		defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+		os.Setenv("XDG_CONFIG_HOME", "/Users/test/xdg")
 
 		mockFS := mock.NewFileSystem(ctrl)
 		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
-		var writer bytes.Buffer
-		mockFS.EXPECT().CreateDirIfNotExist(gomock.Eq("/Users/test/.tmuxp")).Return(nil)
-		mockFS.EXPECT().Create("tmuxp-config.yaml").Return(&writer, nil)
-		tmuxpCfg, _ := tmuxp.NewConfig("session", tmuxp.Windows{{Name: "window"}}, tmuxp.Environment{"TEST_ENV": "value", "ANOTHER_TEST_ENV": "another-value"}, mockFS)
+		mockFS.EXPECT().Stat("/Users/test/xdg/tmuxp").Return(dirInfo{}, nil)
 
-		err := tmuxpCfg.Save("tmuxp-config.yaml")
+		dir, err := tmuxp.DefaultConfigsDir(mockFS)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/Users/test/xdg/tmuxp", dir)
+	})
+
+	t.Run("should use .tmuxp in home dir otherwise", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+
+		dir, err := tmuxp.DefaultConfigsDir(mockFS)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/Users/test/.tmuxp", dir)
+	})
+}
+
+func TestSave(t *testing.T) {
+	t.Run("should save the tmuxp config as file", func(t *testing.T) {
+		fs := filesystem.NewMemory("/Users/test")
+		tmuxpCfg, _ := tmuxp.NewConfig("session", tmuxp.Windows{{Name: "window"}}, tmuxp.Environment{"TEST_ENV": "value", "ANOTHER_TEST_ENV": "another-value"}, fs)
+
+		err := tmuxpCfg.Save("/Users/test/.tmuxp/session.yaml")
 
-		actualContent := writer.String()
 		expectedContent := `session_name: session
 windows:
 - window_name: window
@@ -85,7 +130,12 @@ environment:
   TEST_ENV: value
 `
 		assert.Nil(t, err)
-		assert.Equal(t, expectedContent, actualContent)
+		assert.Equal(t, []filesystem.Entry{
+			{Path: "/Users", Mode: os.ModeDir | 0755},
+			{Path: "/Users/test", Mode: os.ModeDir | 0755},
+			{Path: "/Users/test/.tmuxp", Mode: os.ModeDir | 0755},
+			{Path: "/Users/test/.tmuxp/session.yaml", Mode: 0600, Data: []byte(expectedContent)},
+		}, fs.Snapshot())
 	})
 
 	t.Run("should return error if tmuxp config cannot be saved", func(t *testing.T) {
@@ -94,12 +144,31 @@ environment:
 
 		mockFS := mock.NewFileSystem(ctrl)
 		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
 		mockFS.EXPECT().CreateDirIfNotExist(gomock.Eq("/Users/test/.tmuxp")).Return(nil)
-		mockFS.EXPECT().Create("tmuxp-config.yaml").Return(nil, fmt.Errorf("some error"))
+		mockFS.EXPECT().TempFile(".", ".tmuxp-config.yaml.tmp-").Return(nil, "", fmt.Errorf("some error"))
 		tmuxpCfg, _ := tmuxp.NewConfig("session", tmuxp.Windows{{Name: "window"}}, tmuxp.Environment{"TEST_ENV": "value", "ANOTHER_TEST_ENV": "another-value"}, mockFS)
 
 		err := tmuxpCfg.Save("tmuxp-config.yaml")
 
 		assert.EqualError(t, err, "some error")
 	})
+
+	t.Run("should remove the temporary file if it cannot be renamed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFS := mock.NewFileSystem(ctrl)
+		mockFS.EXPECT().HomeDir().Return("/Users/test", nil)
+		mockFS.EXPECT().Stat("/Users/test/.config/tmuxp").Return(nil, &os.PathError{Op: "stat", Err: os.ErrNotExist})
+		mockFS.EXPECT().CreateDirIfNotExist(gomock.Eq("/Users/test/.tmuxp")).Return(nil)
+		mockFS.EXPECT().TempFile(".", ".tmuxp-config.yaml.tmp-").Return(&bytes.Buffer{}, ".tmuxp-config.yaml.tmp-1", nil)
+		mockFS.EXPECT().Rename(".tmuxp-config.yaml.tmp-1", "tmuxp-config.yaml").Return(fmt.Errorf("some error"))
+		mockFS.EXPECT().Remove(".tmuxp-config.yaml.tmp-1").Return(nil)
+		tmuxpCfg, _ := tmuxp.NewConfig("session", tmuxp.Windows{{Name: "window"}}, tmuxp.Environment{}, mockFS)
+
+		err := tmuxpCfg.Save("tmuxp-config.yaml")
+
+		assert.EqualError(t, err, "some error")
+	})
 }
@@ -0,0 +1,57 @@
+package watch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PIDFile guards against running more than one watcher
+type PIDFile struct {
+	path string
+}
+
+// AcquirePIDFile writes the pid of the current process to the given file.
+// It fails if the file belongs to a process that is still running and
+// replaces it if the process is gone.
+func AcquirePIDFile(file string) (*PIDFile, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &PIDFile{path: file}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if pid, err := readPID(file); err == nil && processExists(pid) {
+			return nil, fmt.Errorf("another kube-tmuxp watch is running (pid %d)", pid)
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("error acquiring pid file %s", file)
+}
+
+// Release removes the pid file
+func (p *PIDFile) Release() error {
+	return os.Remove(p.path)
+}
+
+func readPID(file string) (int, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
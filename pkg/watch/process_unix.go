@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package watch
+
+import "syscall"
+
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package watch
+
+import "os"
+
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
@@ -0,0 +1,113 @@
+package watch
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/status"
+)
+
+// Checker reports the status of the kubeconfigs of the given contexts
+type Checker interface {
+	Check(ctx context.Context, contexts []string) status.Contexts
+}
+
+// Refresher re-fetches the kubeconfigs of the given contexts
+type Refresher interface {
+	Refresh(ctx context.Context, contexts []string) error
+}
+
+// Options configures the watcher
+type Options struct {
+	// Interval is the time between two checks
+	Interval time.Duration
+	// Jitter is the maximum random delay added to the interval
+	Jitter time.Duration
+}
+
+// Watcher periodically refreshes kubeconfigs whose
+// credentials are missing, expired or about to expire
+type Watcher struct {
+	checker   Checker
+	refresher Refresher
+	contexts  []string
+	options   Options
+	log       *logging.Logger
+	rand      *rand.Rand
+}
+
+// New returns a new Watcher for the given contexts
+func New(checker Checker, refresher Refresher, contexts []string, options Options, log *logging.Logger) *Watcher {
+	return &Watcher{
+		checker:   checker,
+		refresher: refresher,
+		contexts:  contexts,
+		options:   options,
+		log:       log,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run checks the kubeconfigs every interval until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	w.log.Info("Watching contexts", "contexts", len(w.contexts), "interval", w.options.Interval)
+	for {
+		w.Tick(ctx)
+
+		timer := time.NewTimer(w.nextDelay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			w.log.Info("Shutting down")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// Tick checks the kubeconfigs once and refreshes the ones that need it.
+// It returns the contexts that were refreshed successfully.
+func (w *Watcher) Tick(ctx context.Context) []string {
+	var refreshed []string
+	for _, s := range w.checker.Check(ctx, w.contexts) {
+		reason := refreshReason(s)
+		if reason == "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return refreshed
+		}
+
+		w.log.Info("Refreshing context", "context", s.Name, "reason", reason)
+		if err := w.refresher.Refresh(ctx, []string{s.Name}); err != nil {
+			w.log.Error("Failed to refresh context", "context", s.Name, "error", err)
+			continue
+		}
+		refreshed = append(refreshed, s.Name)
+	}
+	return refreshed
+}
+
+func (w *Watcher) nextDelay() time.Duration {
+	if w.options.Jitter <= 0 {
+		return w.options.Interval
+	}
+	return w.options.Interval + time.Duration(w.rand.Int63n(int64(w.options.Jitter)))
+}
+
+func refreshReason(s status.Context) string {
+	if !s.Exists {
+		return "kubeconfig is missing"
+	}
+	for _, cred := range s.Credentials {
+		switch cred.State {
+		case status.Expired:
+			return cred.Kind + " has expired"
+		case status.Expiring:
+			return cred.Kind + " is about to expire"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package watch_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/logging"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/status"
+	"github.com/thecasualcoder/kube-tmuxp/pkg/watch"
+)
+
+type fakeChecker struct {
+	statuses status.Contexts
+}
+
+func (f *fakeChecker) Check(_ context.Context, _ []string) status.Contexts {
+	return f.statuses
+}
+
+type fakeRefresher struct {
+	sync.Mutex
+	refreshed []string
+	failing   map[string]bool
+	onRefresh func()
+}
+
+func (f *fakeRefresher) Refresh(_ context.Context, contexts []string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.onRefresh != nil {
+		f.onRefresh()
+	}
+	if f.failing[contexts[0]] {
+		return fmt.Errorf("some error")
+	}
+	f.refreshed = append(f.refreshed, contexts...)
+	return nil
+}
+
+var statuses = status.Contexts{
+	{Name: "valid", Exists: true, Credentials: []status.Credential{{Kind: "token", State: status.Valid}}},
+	{Name: "exec", Exists: true, Credentials: []status.Credential{{Kind: "exec:gke-gcloud-auth-plugin", State: status.Unknown}}},
+	{Name: "expiring", Exists: true, Credentials: []status.Credential{{Kind: "token", State: status.Expiring}}},
+	{Name: "expired", Exists: true, Credentials: []status.Credential{{Kind: "client-certificate", State: status.Expired}}},
+	{Name: "missing"},
+}
+
+func TestTick(t *testing.T) {
+	t.Run("should refresh only missing, expired and expiring kubeconfigs", func(t *testing.T) {
+		var logs bytes.Buffer
+		refresher := &fakeRefresher{}
+		watcher := watch.New(&fakeChecker{statuses: statuses}, refresher, nil, watch.Options{}, logging.New(&logs, logging.InfoLevel, logging.TextFormat))
+
+		refreshed := watcher.Tick(context.Background())
+
+		assert.Equal(t, []string{"expiring", "expired", "missing"}, refreshed)
+		assert.Equal(t, []string{"expiring", "expired", "missing"}, refresher.refreshed)
+		assert.Equal(t, `Refreshing context context=expiring reason="token is about to expire"
+Refreshing context context=expired reason="client-certificate has expired"
+Refreshing context context=missing reason="kubeconfig is missing"
+`, logs.String())
+	})
+
+	t.Run("should refresh kubeconfigs with exec credentials of unknown expiry only when missing", func(t *testing.T) {
+		refresher := &fakeRefresher{}
+		exec := []status.Credential{{Kind: "exec:gke-gcloud-auth-plugin", State: status.Unknown}}
+		checker := &fakeChecker{statuses: status.Contexts{
+			{Name: "exec", Exists: true, Credentials: exec},
+			{Name: "missing-exec", Credentials: exec},
+		}}
+		watcher := watch.New(checker, refresher, nil, watch.Options{}, nil)
+
+		refreshed := watcher.Tick(context.Background())
+
+		assert.Equal(t, []string{"missing-exec"}, refreshed)
+	})
+
+	t.Run("should continue refreshing other kubeconfigs if one fails", func(t *testing.T) {
+		var logs bytes.Buffer
+		refresher := &fakeRefresher{failing: map[string]bool{"expiring": true}}
+		watcher := watch.New(&fakeChecker{statuses: statuses}, refresher, nil, watch.Options{}, logging.New(&logs, logging.InfoLevel, logging.TextFormat))
+
+		refreshed := watcher.Tick(context.Background())
+
+		assert.Equal(t, []string{"expired", "missing"}, refreshed)
+		assert.Contains(t, logs.String(), "error: Failed to refresh context context=expiring error=\"some error\"\n")
+	})
+
+	t.Run("should stop refreshing once the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		refresher := &fakeRefresher{onRefresh: cancel}
+		watcher := watch.New(&fakeChecker{statuses: statuses}, refresher, nil, watch.Options{}, nil)
+
+		refreshed := watcher.Tick(ctx)
+
+		assert.Equal(t, []string{"expiring"}, refreshed)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should check periodically until the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		refresher := &fakeRefresher{}
+		ticks := 0
+		refresher.onRefresh = func() {
+			ticks++
+			if ticks == 2 {
+				cancel()
+			}
+		}
+		checker := &fakeChecker{statuses: status.Contexts{{Name: "missing"}}}
+		watcher := watch.New(checker, refresher, []string{"missing"}, watch.Options{Interval: time.Millisecond, Jitter: time.Millisecond}, nil)
+
+		done := make(chan error)
+		go func() { done <- watcher.Run(ctx) }()
+
+		select {
+		case err := <-done:
+			assert.Nil(t, err)
+			assert.Equal(t, 2, ticks)
+		case <-time.After(5 * time.Second):
+			t.Fatal("watcher did not stop after the context was cancelled")
+		}
+	})
+}
+
+func TestAcquirePIDFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kube-tmuxp-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("should write the pid and remove it on release", func(t *testing.T) {
+		file := path.Join(dir, "watch.pid")
+
+		pidFile, err := watch.AcquirePIDFile(file)
+
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadFile(file)
+		assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+		assert.Nil(t, pidFile.Release())
+		_, err = os.Stat(file)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("should fail if the pid file belongs to a running process", func(t *testing.T) {
+		file := path.Join(dir, "running.pid")
+		pidFile, _ := watch.AcquirePIDFile(file)
+		defer pidFile.Release()
+
+		_, err := watch.AcquirePIDFile(file)
+
+		assert.EqualError(t, err, fmt.Sprintf("another kube-tmuxp watch is running (pid %d)", os.Getpid()))
+	})
+
+	t.Run("should replace a stale pid file", func(t *testing.T) {
+		file := path.Join(dir, "stale.pid")
+		assert.Nil(t, ioutil.WriteFile(file, []byte(fmt.Sprintf("%d\n", math.MaxInt32)), 0644))
+
+		pidFile, err := watch.AcquirePIDFile(file)
+
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadFile(file)
+		assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+		assert.Nil(t, pidFile.Release())
+	})
+}